@@ -0,0 +1,239 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denver-code/moza-backend/database/model"
+
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionRegister             = "auth.register"
+	ActionLogin                = "auth.login"
+	ActionLoginFailed          = "auth.login_failed"
+	ActionLogout               = "auth.logout"
+	ActionLogoutAll            = "auth.logout_all"
+	ActionSessionRevoked       = "auth.session_revoked"
+	ActionPasswordChanged      = "auth.password_changed"
+	ActionPasswordReset        = "auth.password_reset"
+	ActionEmailChangeRequested = "auth.email_change_requested"
+	ActionEmailVerified        = "auth.email_verified"
+	ActionTwoFactorEnabled     = "auth.2fa_enabled"
+	ActionTwoFactorDisabled    = "auth.2fa_disabled"
+	ActionProfileUpdated       = "user.profile_updated"
+
+	ActionAccountCreated    = "account.created"
+	ActionAccountFrozen     = "account.frozen"
+	ActionAccountUnfrozen   = "account.unfrozen"
+	ActionAccountClosed     = "account.closed"
+	ActionCardCreated       = "card.created"
+	ActionCardFrozen        = "card.frozen"
+	ActionCardUnfrozen      = "card.unfrozen"
+	ActionCardCancelled     = "card.cancelled"
+	ActionCardReplaced      = "card.replaced"
+	ActionCardRevealed      = "card.revealed"
+	ActionCardAuthorized    = "payment.card_authorized"
+	ActionCardDeclined      = "payment.card_declined"
+	ActionCardCaptured      = "payment.card_captured"
+	ActionCardReleased      = "payment.card_released"
+	ActionHoldPlaced        = "hold.placed"
+	ActionHoldReleased      = "hold.released"
+	ActionTransfer          = "payment.transfer"
+	ActionDeposit           = "payment.deposit"
+	ActionWithdrawal        = "payment.withdrawal"
+	ActionPotCreated        = "pot.created"
+	ActionPotDeposit        = "pot.deposit"
+	ActionPotWithdrawal     = "pot.withdrawal"
+	ActionScheduleCreated   = "schedule.created"
+	ActionScheduleUpdated   = "schedule.updated"
+	ActionScheduleCancelled = "schedule.cancelled"
+
+	ActionRoleChanged         = "admin.role_changed"
+	ActionBalanceAdjusted     = "admin.balance_adjusted"
+	ActionTransactionReversed = "admin.transaction_reversed"
+	ActionRatesUpdated        = "admin.fx_rates_updated"
+	ActionKeyRotated          = "admin.signing_key_rotated"
+	ActionKeysRevoked         = "admin.signing_keys_revoked"
+)
+
+// chainLock is the advisory lock key serialising appends to the hash chain
+const chainLock = 0x6d6f7a61 // "moza"
+
+// Event describes something to record, Before and After are marshalled to JSON
+type Event struct {
+	ActorID    *uint
+	ActorRole  model.Role
+	Action     string
+	TargetType string
+	TargetID   any
+	IP         string
+	UserAgent  string
+	Before     any
+	After      any
+}
+
+// Record appends an event to the audit log, chaining it to the previous event
+func Record(db *gorm.DB, e Event) (*model.AuditEvent, error) {
+	before, err := snapshot(e.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := snapshot(e.After)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &model.AuditEvent{
+		ActorID:    e.ActorID,
+		ActorRole:  e.ActorRole,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		Before:     before,
+		After:      after,
+	}
+	if e.TargetID != nil {
+		event.TargetID = fmt.Sprint(e.TargetID)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLock).Error; err != nil {
+			return err
+		}
+
+		var last model.AuditEvent
+		if err := tx.Select("hash").Order("id desc").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+
+		// Postgres keeps microseconds, hash the value that will be read back
+		event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		event.PrevHash = last.Hash
+		event.Hash = Hash(event)
+		return tx.Create(event).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Hash computes the chain hash of an event from its content and the previous hash
+func Hash(e *model.AuditEvent) string {
+	actor := ""
+	if e.ActorID != nil {
+		actor = strconv.FormatUint(uint64(*e.ActorID), 10)
+	}
+
+	fields := []string{
+		e.PrevHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		actor,
+		string(e.ActorRole),
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		e.IP,
+		e.UserAgent,
+		string(e.Before),
+		string(e.After),
+	}
+
+	// Length prefixes keep field boundaries unambiguous
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(strconv.Itoa(len(f)))
+		b.WriteByte(':')
+		b.WriteString(f)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify walks the whole chain and returns the ID of the first event whose hash
+// or link to the previous event does not match, or 0 if the chain is intact.
+// Removing the newest events can only be noticed by comparing the returned count
+// and the latest hash with a copy kept elsewhere.
+func Verify(db *gorm.DB) (uint, int, error) {
+	const batchSize = 1000
+
+	prevHash := ""
+	lastID := uint(0)
+	checked := 0
+	for {
+		var events []model.AuditEvent
+		if err := db.Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&events).Error; err != nil {
+			return 0, checked, err
+		}
+
+		valid, hash := verifyEvents(prevHash, events)
+		checked += valid
+		if valid < len(events) {
+			return events[valid].ID, checked, nil
+		}
+		if len(events) > 0 {
+			prevHash = hash
+			lastID = events[len(events)-1].ID
+		}
+
+		if len(events) < batchSize {
+			return 0, checked, nil
+		}
+	}
+}
+
+// verifyEvents checks consecutive events against the hash of the event before them.
+// It returns how many events are intact before the first broken one, and the hash
+// the next event has to link to.
+func verifyEvents(prevHash string, events []model.AuditEvent) (int, string) {
+	for i := range events {
+		e := &events[i]
+		if e.PrevHash != prevHash || Hash(e) != e.Hash {
+			return i, prevHash
+		}
+		prevHash = e.Hash
+	}
+	return len(events), prevHash
+}
+
+func snapshot(v any) (model.Snapshot, error) {
+	if v == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return model.Snapshot(data), nil
+}
+
+// CardSnapshot describes a card for the audit log without its number or CVV
+func CardSnapshot(card *model.Card) map[string]any {
+	last4 := card.MaskedNumber
+	if len(last4) > 4 {
+		last4 = last4[len(last4)-4:]
+	}
+	return map[string]any{
+		"id":              card.ID,
+		"user_id":         card.UserID,
+		"bank_account_id": card.BankAccountID,
+		"last4":           last4,
+		"expiry_date":     card.ExpiryDate,
+		"status":          card.Status,
+		"is_active":       card.IsActive,
+		"daily_limit":     card.DailyLimit,
+		"card_type":       card.CardType,
+		"cancel_reason":   card.CancelReason,
+		"replaces_card":   card.ReplacesCardID,
+		"replaced_by":     card.ReplacedByCardID,
+	}
+}
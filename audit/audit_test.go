@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/denver-code/moza-backend/database/model"
+)
+
+// chain builds n linked events the way Record does
+func chain(n int) []model.AuditEvent {
+	events := make([]model.AuditEvent, n)
+	prevHash := ""
+	actor := uint(7)
+	for i := range events {
+		e := &events[i]
+		e.ID = uint(i + 1)
+		e.CreatedAt = time.Date(2024, 5, 1, 12, 0, i, 0, time.UTC)
+		e.ActorID = &actor
+		e.ActorRole = model.ROLE_ADMIN
+		e.Action = ActionCardFrozen
+		e.TargetType = "card"
+		e.TargetID = "42"
+		e.After = `{"status":"FROZEN"}`
+		e.PrevHash = prevHash
+		e.Hash = Hash(e)
+		prevHash = e.Hash
+	}
+	return events
+}
+
+func TestHash(t *testing.T) {
+	e := chain(1)[0]
+	if Hash(&e) != e.Hash {
+		t.Fatal("hash is not deterministic")
+	}
+
+	changes := map[string]func(e *model.AuditEvent){
+		"action":    func(e *model.AuditEvent) { e.Action = ActionCardUnfrozen },
+		"actor":     func(e *model.AuditEvent) { e.ActorID = nil },
+		"time":      func(e *model.AuditEvent) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) },
+		"snapshot":  func(e *model.AuditEvent) { e.After = `{"status":"ACTIVE"}` },
+		"prev hash": func(e *model.AuditEvent) { e.PrevHash = "x" },
+		// Moving text between fields must change the hash too
+		"boundary": func(e *model.AuditEvent) { e.TargetType, e.TargetID = "card4", "2" },
+	}
+	for name, change := range changes {
+		changed := e
+		change(&changed)
+		if Hash(&changed) == e.Hash {
+			t.Errorf("changing the %s kept the hash", name)
+		}
+	}
+}
+
+func TestVerifyEvents(t *testing.T) {
+	events := chain(5)
+	if valid, last := verifyEvents("", events); valid != 5 || last != events[4].Hash {
+		t.Errorf("intact chain: %d valid, last hash %q", valid, last)
+	}
+
+	// A batch continues from the hash of the previous batch
+	if valid, _ := verifyEvents(events[1].Hash, events[2:]); valid != 3 {
+		t.Errorf("second batch: %d valid, want 3", valid)
+	}
+	if valid, _ := verifyEvents("", events[2:]); valid != 0 {
+		t.Errorf("batch with a wrong starting hash: %d valid, want 0", valid)
+	}
+
+	tampered := chain(5)
+	tampered[2].After = `{"status":"ACTIVE"}`
+	if valid, _ := verifyEvents("", tampered); valid != 2 {
+		t.Errorf("edited event: %d valid, want 2", valid)
+	}
+
+	removed := append(chain(5)[:1], chain(5)[2:]...)
+	if valid, _ := verifyEvents("", removed); valid != 1 {
+		t.Errorf("removed event: %d valid, want 1", valid)
+	}
+
+	// Recomputing the hash of an edited event still breaks the link of the next one
+	rehashed := chain(5)
+	rehashed[2].After = `{"status":"ACTIVE"}`
+	rehashed[2].Hash = Hash(&rehashed[2])
+	if valid, _ := verifyEvents("", rehashed); valid != 3 {
+		t.Errorf("rehashed event: %d valid, want 3", valid)
+	}
+}
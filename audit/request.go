@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"log"
+
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Log records an event made through an HTTP request. The actor is taken from the
+// access token unless the event sets one, the client IP and user agent from the request.
+// Failures are logged rather than returned so auditing never undoes a completed action.
+func Log(c *fiber.Ctx, e Event) {
+	if token, ok := c.Locals("user").(*jwt.Token); ok && e.ActorID == nil {
+		claims := token.Claims.(jwt.MapClaims)
+		if userID, ok := claims["user_id"].(float64); ok {
+			id := uint(userID)
+			e.ActorID = &id
+		}
+		if role, ok := claims["role"].(string); ok {
+			e.ActorRole = model.Role(role)
+		}
+	}
+	e.IP = c.IP()
+	e.UserAgent = c.Get(fiber.HeaderUserAgent)
+
+	if _, err := Record(database.DB, e); err != nil {
+		log.Printf("audit: could not record %s: %v", e.Action, err)
+	}
+}
@@ -0,0 +1,460 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/encryption"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultKeyRotation = 30 * 24 * time.Hour
+
+	// JWKSMaxAge is how long clients may cache the published key set
+	JWKSMaxAge = 5 * time.Minute
+
+	// keyReloadInterval is how often the key set is refreshed from the database,
+	// so keys rotated by another instance are picked up
+	keyReloadInterval = time.Minute
+	// keyPublishLead is how long a new key is published before it signs, so every
+	// instance has loaded it and every cached key set contains it
+	keyPublishLead = JWKSMaxAge + keyReloadInterval
+	// unknownKidReload limits reloads caused by tokens with an unknown kid
+	unknownKidReload = 10 * time.Second
+	rsaKeyBits       = 2048
+)
+
+var (
+	ErrUnknownKey         = errors.New("unknown signing key")
+	ErrUnsupportedKeyAlg  = errors.New("unsupported signing algorithm")
+	ErrNoSigningKey       = errors.New("no signing key available")
+	ErrUnexpectedKeyBlock = errors.New("unexpected key encoding")
+)
+
+// KeyAlgorithm returns the algorithm new signing keys are generated for, RS256 or EdDSA
+func KeyAlgorithm() string {
+	if strings.EqualFold(config.Config("JWT_ALGORITHM"), "EdDSA") {
+		return "EdDSA"
+	}
+	return "RS256"
+}
+
+// KeyRotationInterval returns how long a key signs tokens before it is replaced
+func KeyRotationInterval() time.Duration {
+	return duration("JWT_KEY_ROTATION", DefaultKeyRotation)
+}
+
+type signingKey struct {
+	kid         string
+	method      jwt.SigningMethod
+	private     crypto.Signer
+	public      crypto.PublicKey
+	activatesAt time.Time
+	retired     bool
+	expiresAt   *time.Time
+}
+
+// keySet holds the parsed keys of the signing_keys table
+var keySet = struct {
+	sync.RWMutex
+	keys     map[string]*signingKey
+	loadedAt time.Time
+}{keys: map[string]*signingKey{}}
+
+// SetupKeys encrypts private keys stored before they were sealed, creates the first
+// signing key if there is none and loads the key set
+func SetupKeys(db *gorm.DB) error {
+	if err := sealPlaintextKeys(db); err != nil {
+		return err
+	}
+	if _, err := rotateIfDue(db, time.Now()); err != nil {
+		return err
+	}
+	return LoadKeys(db)
+}
+
+// StartKeyRotation reloads the key set and rotates the signing key when it is due,
+// until the process exits
+func StartKeyRotation(db *gorm.DB) {
+	ticker := time.NewTicker(keyReloadInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if published, err := rotateIfDue(db, now); err != nil {
+			log.Printf("keys: %v", err)
+		} else if published {
+			log.Printf("keys: published the next access token signing key")
+		}
+		if err := LoadKeys(db); err != nil {
+			log.Printf("keys: %v", err)
+		}
+	}
+}
+
+// LoadKeys replaces the in-memory key set with the unexpired keys in the database
+func LoadKeys(db *gorm.DB) error {
+	var rows []model.SigningKey
+	if err := db.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at").
+		Find(&rows).Error; err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(rows))
+	for _, row := range rows {
+		key, err := parseSigningKey(row)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.KID, err)
+		}
+		keys[key.kid] = key
+	}
+
+	keySet.Lock()
+	defer keySet.Unlock()
+	keySet.keys = keys
+	keySet.loadedAt = time.Now()
+	return nil
+}
+
+// RotateKey generates a new signing key that signs at once and retires the current
+// one, for example when a key may have leaked. Verifiers with a cached key set reject
+// new tokens until their cache expires, scheduled rotation publishes keys ahead instead.
+// Retired keys keep verifying tokens until every token they signed has expired, unless
+// revoke is set: then every existing key stops verifying at once, on other instances
+// after their next reload, and everyone signed in has to refresh or sign in again.
+func RotateKey(db *gorm.DB, revoke bool) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if revoke {
+			if err := revokeAll(tx, now); err != nil {
+				return err
+			}
+		}
+		return rotate(tx, now)
+	})
+	if err != nil {
+		return err
+	}
+	return LoadKeys(db)
+}
+
+// rotateIfDue publishes the next signing key keyPublishLead before the current one
+// is due for rotation, and retires keys once their successor has started signing.
+// When there is no key at all the first one signs at once. The active keys are
+// locked so only one instance rotates. It reports whether a key was created.
+func rotateIfDue(db *gorm.DB, now time.Time) (bool, error) {
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var active []model.SigningKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("retired_at IS NULL").
+			Find(&active).Error; err != nil {
+			return err
+		}
+		if len(active) == 0 {
+			created = true
+			return createKey(tx, now)
+		}
+		sort.Slice(active, func(i, j int) bool { return active[i].Activation().Before(active[j].Activation()) })
+
+		// Keys older than the newest signing key are replaced
+		signing := 0
+		for i := range active {
+			if !active[i].Activation().After(now) {
+				signing = i
+			}
+		}
+		if signing > 0 {
+			ids := make([]uint, signing)
+			for i := range ids {
+				ids[i] = active[i].ID
+			}
+			if err := retire(tx, now, ids); err != nil {
+				return err
+			}
+		}
+
+		latest := active[len(active)-1]
+		if latest.Activation().After(now) {
+			return nil // the next key is already published
+		}
+		due := latest.Activation().Add(KeyRotationInterval())
+		if now.Before(due.Add(-keyPublishLead)) {
+			return nil
+		}
+		created = true
+		return createKey(tx, maxTime(due, now.Add(keyPublishLead)))
+	})
+	return created, err
+}
+
+func rotate(tx *gorm.DB, now time.Time) error {
+	if err := retire(tx, now, nil); err != nil {
+		return err
+	}
+	return createKey(tx, now)
+}
+
+// retire stops the given keys, or all active keys when ids is nil, from signing.
+// Instances may keep signing with them until their next reload.
+func retire(tx *gorm.DB, now time.Time, ids []uint) error {
+	query := tx.Model(&model.SigningKey{}).Where("retired_at IS NULL")
+	if ids != nil {
+		query = query.Where("id IN ?", ids)
+	}
+	expiresAt := now.Add(AccessTokenTTL() + keyReloadInterval)
+	return query.Updates(map[string]any{"retired_at": now, "expires_at": expiresAt}).Error
+}
+
+// revokeAll expires every key that still verifies tokens, including keys published
+// ahead of rotation, since a leak of one key may have exposed them all
+func revokeAll(tx *gorm.DB, now time.Time) error {
+	return tx.Model(&model.SigningKey{}).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Updates(map[string]any{"retired_at": gorm.Expr("COALESCE(retired_at, ?)", now), "expires_at": now}).Error
+}
+
+// createKey stores a new signing key that starts signing at activatesAt
+func createKey(tx *gorm.DB, activatesAt time.Time) error {
+	key, err := generateSigningKey(KeyAlgorithm())
+	if err != nil {
+		return err
+	}
+	key.ActivatesAt = &activatesAt
+	return tx.Create(key).Error
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// currentSigningKey returns the key new tokens are signed with, the active key
+// that started signing last
+func currentSigningKey() (*signingKey, error) {
+	keySet.RLock()
+	defer keySet.RUnlock()
+
+	now := time.Now()
+	var current *signingKey
+	for _, key := range keySet.keys {
+		if key.retired || key.activatesAt.After(now) {
+			continue
+		}
+		if current == nil || key.activatesAt.After(current.activatesAt) {
+			current = key
+		}
+	}
+	if current == nil {
+		return nil, ErrNoSigningKey
+	}
+	return current, nil
+}
+
+// lookupKey finds a verification key by kid, reloading the key set once in a
+// while so keys created by another instance are found
+func lookupKey(db *gorm.DB, kid string) (*signingKey, error) {
+	keySet.RLock()
+	key, ok := keySet.keys[kid]
+	stale := time.Since(keySet.loadedAt) > unknownKidReload
+	keySet.RUnlock()
+
+	if !ok && stale && db != nil {
+		if err := LoadKeys(db); err != nil {
+			return nil, err
+		}
+		keySet.RLock()
+		key, ok = keySet.keys[kid]
+		keySet.RUnlock()
+	}
+	if !ok || (key.expiresAt != nil && time.Now().After(*key.expiresAt)) {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// KeyFunc returns a jwt.Keyfunc that verifies tokens against the key set
+func KeyFunc(db *gorm.DB) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrUnknownKey
+		}
+		key, err := lookupKey(db, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, ErrUnsupportedKeyAlg
+		}
+		return key.public, nil
+	}
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys that tokens may currently be verified with,
+// including the next key before it starts signing
+func JWKS() []JWK {
+	keySet.RLock()
+	defer keySet.RUnlock()
+
+	now := time.Now()
+	keys := make([]JWK, 0, len(keySet.keys))
+	for _, key := range keySet.keys {
+		if key.expiresAt != nil && now.After(*key.expiresAt) {
+			continue
+		}
+		jwk := JWK{Use: "sig", KeyID: key.kid, Algorithm: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	return keys
+}
+
+func generateSigningKey(algorithm string) (*model.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrUnsupportedKeyAlg
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	kid, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	kid = kid[:16]
+	sealed, err := encryption.Seal(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})), privateKeyContext(kid))
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.SigningKey{
+		KID:        kid,
+		Algorithm:  algorithm,
+		PrivateKey: sealed,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// privateKeyContext binds a sealed private key to its kid
+func privateKeyContext(kid string) string {
+	return "signing_key." + kid
+}
+
+// sealPlaintextKeys encrypts private keys stored as plain PEM by earlier versions
+func sealPlaintextKeys(db *gorm.DB) error {
+	var rows []model.SigningKey
+	if err := db.Unscoped().Where("private_key LIKE ?", "-----BEGIN%").Find(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		sealed, err := encryption.Seal(row.PrivateKey, privateKeyContext(row.KID))
+		if err != nil {
+			return err
+		}
+		if err := db.Unscoped().Model(&model.SigningKey{}).Where("id = ?", row.ID).Update("private_key", sealed).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSigningKey(row model.SigningKey) (*signingKey, error) {
+	key := &signingKey{
+		kid:         row.KID,
+		activatesAt: row.Activation(),
+		retired:     row.RetiredAt != nil,
+		expiresAt:   row.ExpiresAt,
+	}
+	switch row.Algorithm {
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKeyAlg
+	}
+
+	privatePEM, err := encryption.Open(row.PrivateKey, privateKeyContext(row.KID))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, ErrUnexpectedKeyBlock
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.private = private
+	case ed25519.PrivateKey:
+		key.private = private
+	default:
+		return nil, ErrUnexpectedKeyBlock
+	}
+	key.public = key.private.Public()
+	return key, nil
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/denver-code/moza-backend/database/model"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// cacheTTL bounds how long another instance's revocation can go unnoticed
+const cacheTTL = 30 * time.Second
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+// revocationCache memoises revocation lookups so Protected does not hit the
+// database on every request. Revocations made by this instance update it directly.
+var revocationCache = struct {
+	sync.RWMutex
+	entries map[string]cacheEntry
+}{entries: map[string]cacheEntry{}}
+
+func cached(key string, load func() (any, error)) (any, error) {
+	revocationCache.RLock()
+	entry, ok := revocationCache.entries[key]
+	revocationCache.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	setCached(key, value)
+	return value, nil
+}
+
+func setCached(key string, value any) {
+	revocationCache.Lock()
+	defer revocationCache.Unlock()
+
+	now := time.Now()
+	for k, e := range revocationCache.entries {
+		if now.After(e.expires) {
+			delete(revocationCache.entries, k)
+		}
+	}
+	revocationCache.entries[key] = cacheEntry{value: value, expires: now.Add(cacheTTL)}
+}
+
+func tokenKey(jti string) string { return "jti:" + jti }
+func userKey(id uint) string     { return "user:" + strconv.FormatUint(uint64(id), 10) }
+func sessionKey(id uint) string  { return "session:" + strconv.FormatUint(uint64(id), 10) }
+
+// CheckToken rejects access tokens that were revoked, belong to a revoked session
+// or were issued before the user's tokens were invalidated
+func CheckToken(db *gorm.DB, claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	userID, okUser := claims["user_id"].(float64)
+	sid, okSession := claims["sid"].(float64)
+	iat, okIssued := claims["iat"].(float64)
+	if jti == "" || !okUser || !okSession || !okIssued {
+		return ErrTokenRevoked
+	}
+
+	revoked, err := cached(tokenKey(jti), func() (any, error) {
+		var count int64
+		err := db.Model(&model.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+		return count > 0, err
+	})
+	if err != nil {
+		return err
+	}
+	if revoked.(bool) {
+		return ErrTokenRevoked
+	}
+
+	validAfter, err := cached(userKey(uint(userID)), func() (any, error) {
+		var user model.User
+		if err := db.Select("tokens_valid_after").First(&user, uint(userID)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return time.Now(), nil
+			}
+			return nil, err
+		}
+		if user.TokensValidAfter == nil {
+			return time.Time{}, nil
+		}
+		return *user.TokensValidAfter, nil
+	})
+	if err != nil {
+		return err
+	}
+	// Tokens issued before iat_us existed count as issued at the start of their second
+	issuedAt := time.Unix(int64(iat), 0)
+	if us, ok := claims["iat_us"].(float64); ok {
+		issuedAt = time.UnixMicro(int64(us))
+	}
+	if issuedAt.Before(validAfter.(time.Time)) {
+		return ErrTokenRevoked
+	}
+
+	active, err := cached(sessionKey(uint(sid)), func() (any, error) {
+		var session model.Session
+		if err := db.First(&session, uint(sid)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return nil, err
+		}
+		return session.RevokedAt == nil && time.Now().Before(session.ExpiresAt), nil
+	})
+	if err != nil {
+		return err
+	}
+	if !active.(bool) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// RevokeToken blocks a single access token until it expires
+func RevokeToken(db *gorm.DB, claims jwt.MapClaims, reason string) error {
+	jti, _ := claims["jti"].(string)
+	userID, _ := claims["user_id"].(float64)
+	exp, _ := claims["exp"].(float64)
+	if jti == "" {
+		return nil
+	}
+
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.RevokedToken{
+		JTI:       jti,
+		UserID:    uint(userID),
+		ExpiresAt: time.Unix(int64(exp), 0),
+		Reason:    reason,
+	}).Error
+	if err == nil {
+		setCached(tokenKey(jti), true)
+	}
+	return err
+}
+
+// RevokeAllForUser invalidates every token and session of a user, for example
+// after a password change or a forced logout
+func RevokeAllForUser(db *gorm.DB, userID uint) error {
+	// Postgres keeps microseconds, the cache must hold the same value as the database
+	now := time.Now().Truncate(time.Microsecond)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).Update("tokens_valid_after", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+	if err == nil {
+		setCached(userKey(userID), now)
+	}
+	return err
+}
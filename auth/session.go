@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/denver-code/moza-backend/database/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+)
+
+// Tokens is the pair of credentials handed to a client after authentication
+type Tokens struct {
+	AccessToken  string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+	SessionID    uint      `json:"session_id"`
+}
+
+// StartSession opens a new session for the user and issues its first tokens
+func StartSession(db *gorm.DB, user *model.User, userAgent, ip string) (*Tokens, error) {
+	session := &model.Session{
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastUsedAt: time.Now(),
+		ExpiresAt:  time.Now().Add(RefreshTokenTTL()),
+	}
+
+	var tokens *Tokens
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		var err error
+		tokens, err = issue(tx, user, session)
+		return err
+	})
+	return tokens, err
+}
+
+// Refresh exchanges a refresh token for a new token pair of the same session.
+// Each refresh token works once, replaying one revokes the session.
+func Refresh(db *gorm.DB, refreshToken, userAgent, ip string) (*Tokens, error) {
+	var tokens *Tokens
+	reused := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var stored model.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(refreshToken)).
+			First(&stored).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		var session model.Session
+		if err := tx.First(&session, stored.SessionID).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		now := time.Now()
+		if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// A used token means it leaked, end the session for everyone holding it
+		if stored.UsedAt != nil {
+			reused = true
+			return RevokeSession(tx, session.ID)
+		}
+		if now.After(stored.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Model(&stored).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		var user model.User
+		if err := tx.First(&user, session.UserID).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Model(&session).Updates(map[string]any{
+			"user_agent":   userAgent,
+			"ip":           ip,
+			"last_used_at": now,
+			"expires_at":   now.Add(RefreshTokenTTL()),
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		tokens, err = issue(tx, &user, &session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+	return tokens, nil
+}
+
+// RevokeSession ends a session, its refresh and access tokens stop working immediately
+func RevokeSession(db *gorm.DB, sessionID uint) error {
+	err := db.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+	if err == nil {
+		setCached(sessionKey(sessionID), false)
+	}
+	return err
+}
+
+// ActiveSessions lists the sessions of a user that can still be refreshed
+func ActiveSessions(db *gorm.DB, userID uint) ([]model.Session, error) {
+	var sessions []model.Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// issue signs an access token and stores a new refresh token for the session
+func issue(tx *gorm.DB, user *model.User, session *model.Session) (*Tokens, error) {
+	accessToken, expiresAt, err := IssueAccessToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&model.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		AccessToken:  accessToken,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		SessionID:    session.ID,
+	}, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RevokeOtherSessions ends every session of the user except the given one,
+// for example after a password change from that session
+func RevokeOtherSessions(db *gorm.DB, userID, keepSessionID uint) error {
+	var ids []uint
+	if err := db.Model(&model.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := RevokeSession(db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
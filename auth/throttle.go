@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultMaxUserFailures = 5
+	DefaultMaxIPFailures   = 20
+	DefaultLockoutDuration = 15 * time.Minute
+	DefaultFailureWindow   = time.Hour
+	DefaultDelayStep       = time.Second
+	DefaultMaxDelay        = 30 * time.Second
+)
+
+// DefaultMaxSecondFactorFailures bounds wrong two-factor codes across login
+// challenges and step-up checks
+const DefaultMaxSecondFactorFailures = 5
+
+var (
+	ErrLoginLocked    = errors.New("too many failed attempts, temporarily locked")
+	ErrLoginThrottled = errors.New("too many failed attempts, retry later")
+)
+
+// ThrottleError tells the client how long to wait before the next login attempt
+type ThrottleError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string { return e.Err.Error() }
+func (e *ThrottleError) Unwrap() error { return e.Err }
+
+// UserThrottleKey tracks failures against an existing user
+func UserThrottleKey(userID uint) string {
+	return "user:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// IdentityThrottleKey tracks failures against an identity that matches no user,
+// so unknown and known identities are throttled alike
+func IdentityThrottleKey(identity string) string {
+	return "identity:" + strings.ToLower(identity)
+}
+
+// SecondFactorThrottleKey tracks wrong two-factor codes of a user, which are
+// counted separately so a correct password does not clear them
+func SecondFactorThrottleKey(userID uint) string {
+	return "2fa:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// IPThrottleKey tracks failures from a client address across all identities
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// CheckLogin refuses a login attempt while any of the keys is locked or delayed
+func CheckLogin(db *gorm.DB, keys ...string) error {
+	var throttles []model.LoginThrottle
+	if err := db.Where("key IN ?", keys).Find(&throttles).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var locked, delayed time.Duration
+	for _, t := range throttles {
+		if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+			locked = max(locked, t.LockedUntil.Sub(now))
+		} else if now.Before(t.NextAttemptAt) {
+			delayed = max(delayed, t.NextAttemptAt.Sub(now))
+		}
+	}
+
+	if locked > 0 {
+		return &ThrottleError{Err: ErrLoginLocked, RetryAfter: locked}
+	}
+	if delayed > 0 {
+		return &ThrottleError{Err: ErrLoginThrottled, RetryAfter: delayed}
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed attempt against the user or identity key and the IP key,
+// locking them out once their threshold is reached
+func RecordLoginFailure(db *gorm.DB, identityKey string, userID *uint, ip string) error {
+	if err := recordFailure(db, identityKey, userID, ip, configInt("LOGIN_MAX_USER_FAILURES", DefaultMaxUserFailures)); err != nil {
+		return err
+	}
+	return recordFailure(db, IPThrottleKey(ip), nil, ip, configInt("LOGIN_MAX_IP_FAILURES", DefaultMaxIPFailures))
+}
+
+// ResetLogin clears the failures of a key, after a successful login or a password reset
+func ResetLogin(db *gorm.DB, key string) error {
+	return db.Unscoped().Where("key = ?", key).Delete(&model.LoginThrottle{}).Error
+}
+
+func recordFailure(db *gorm.DB, key string, userID *uint, ip string, maxFailures int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.LoginThrottle{Key: key, LastFailureAt: now, NextAttemptAt: now}).Error; err != nil {
+			return err
+		}
+
+		var throttle model.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&throttle).Error; err != nil {
+			return err
+		}
+
+		// Failures older than the window are forgotten
+		if now.Sub(throttle.LastFailureAt) > duration("LOGIN_FAILURE_WINDOW", DefaultFailureWindow) {
+			throttle.Failures = 0
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		throttle.NextAttemptAt = now.Add(loginDelay(throttle.Failures))
+
+		if throttle.Failures >= maxFailures {
+			lockedUntil := now.Add(duration("LOGIN_LOCKOUT_DURATION", DefaultLockoutDuration))
+			throttle.LockedUntil = &lockedUntil
+			if err := tx.Create(&model.LockoutEvent{
+				Key:         key,
+				UserID:      userID,
+				IP:          ip,
+				Failures:    throttle.Failures,
+				LockedUntil: lockedUntil,
+			}).Error; err != nil {
+				return err
+			}
+			// Start counting afresh once the lockout expires
+			throttle.Failures = 0
+		}
+
+		return tx.Save(&throttle).Error
+	})
+}
+
+// loginDelay doubles the wait after each failure, starting from the configured step
+func loginDelay(failures int) time.Duration {
+	delay := duration("LOGIN_DELAY_STEP", DefaultDelayStep)
+	maxDelay := duration("LOGIN_MAX_DELAY", DefaultMaxDelay)
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+func configInt(key string, fallback int) int {
+	n, err := strconv.Atoi(config.Config(key))
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
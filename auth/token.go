@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// AccessTokenTTL returns the lifetime of access tokens
+func AccessTokenTTL() time.Duration {
+	return duration("ACCESS_TOKEN_TTL", DefaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL returns the lifetime of a session without activity
+func RefreshTokenTTL() time.Duration {
+	return duration("REFRESH_TOKEN_TTL", DefaultRefreshTokenTTL)
+}
+
+// IssueAccessToken signs a short-lived JWT for the user within a session
+func IssueAccessToken(user *model.User, sessionID uint) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL())
+
+	jti, err := randomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	key, err := currentSigningKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token := jwt.New(key.method)
+	token.Header["kid"] = key.kid
+	claims := token.Claims.(jwt.MapClaims)
+	claims["username"] = user.Username
+	claims["user_id"] = user.ID
+	claims["role"] = user.Role
+	claims["sid"] = sessionID
+	claims["jti"] = jti
+	claims["iat"] = now.Unix()
+	claims["iat_us"] = now.UnixMicro() // iat is whole seconds, too coarse to compare with tokens_valid_after
+	claims["exp"] = expiresAt.Unix()
+
+	t, err := token.SignedString(key.private)
+	return t, expiresAt, err
+}
+
+func duration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(config.Config(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 test vectors, base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// The last six digits of the eight digit codes in RFC 6238 appendix B
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		step, ok := validateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("code %s was refused at %d", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("code %s matched step %d, want %d", tt.code, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	code := "005924"
+
+	for _, offset := range []time.Duration{-totpPeriod * time.Second, 0, totpPeriod * time.Second} {
+		if _, ok := validateTOTP(rfc6238Secret, code, at.Add(offset)); !ok {
+			t.Errorf("code was refused %v from its step", offset)
+		}
+	}
+	for _, offset := range []time.Duration{-3 * totpPeriod * time.Second, 3 * totpPeriod * time.Second} {
+		if _, ok := validateTOTP(rfc6238Secret, code, at.Add(offset)); ok {
+			t.Errorf("code was accepted %v from its step", offset)
+		}
+	}
+}
+
+func TestValidateTOTPRejects(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"wrong code", rfc6238Secret, "005925"},
+		{"short code", rfc6238Secret, "05924"},
+		{"long code", rfc6238Secret, "0005924"},
+		{"invalid secret", "not base32!", "005924"},
+	}
+	for _, tt := range tests {
+		if _, ok := validateTOTP(tt.secret, tt.code, at); ok {
+			t.Errorf("%s was accepted", tt.name)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/totpPeriod)
+	if _, ok := validateTOTP(secret, code, now); !ok {
+		t.Errorf("code %s for a new secret was refused", code)
+	}
+}
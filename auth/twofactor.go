@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// TOTPIssuer is the name shown next to the account in authenticator apps
+	TOTPIssuer = "Moza"
+
+	recoveryCodeCount      = 10
+	challengeTTL           = 5 * time.Minute
+	maxChallengeAttempts   = 5
+	DefaultStepUpThreshold = 100000 // minor units
+)
+
+var (
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication is not set up")
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrInvalidCode        = errors.New("invalid two-factor code")
+	ErrInvalidChallenge   = errors.New("invalid or expired login challenge")
+)
+
+// StepUpThreshold is the transfer amount, in minor units, from which a second factor is required
+func StepUpThreshold() int64 {
+	n, err := strconv.ParseInt(config.Config("STEP_UP_THRESHOLD"), 10, 64)
+	if err != nil || n < 0 {
+		return DefaultStepUpThreshold
+	}
+	return n
+}
+
+// SetupTOTP generates a new secret for the user. It is not enforced until confirmed.
+func SetupTOTP(db *gorm.DB, user *model.User) (string, string, error) {
+	if user.TOTPEnabled {
+		return "", "", ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := db.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return "", "", err
+	}
+	return secret, TOTPURI(TOTPIssuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their app
+// produces valid codes, and returns freshly generated recovery codes
+func ConfirmTOTP(db *gorm.DB, user *model.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	step, ok := validateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]any{
+			"totp_enabled":      true,
+			"totp_last_counter": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTOTP turns two-factor authentication off and discards the recovery codes
+func DisableTOTP(db *gorm.DB, user *model.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]any{
+			"totp_enabled":      false,
+			"totp_secret":       "",
+			"totp_last_counter": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+// VerifySecondFactor accepts a current TOTP code or an unused recovery code.
+// Each TOTP code and recovery code can only be used once. Wrong codes are
+// throttled per user and lock the second factor after SECOND_FACTOR_MAX_FAILURES.
+func VerifySecondFactor(db *gorm.DB, userID uint, code string) error {
+	key := SecondFactorThrottleKey(userID)
+	if err := CheckLogin(db, key); err != nil {
+		return err
+	}
+
+	err := verifySecondFactor(db, userID, code)
+	switch {
+	case errors.Is(err, ErrInvalidCode):
+		if err := recordFailure(db, key, &userID, "", configInt("SECOND_FACTOR_MAX_FAILURES", DefaultMaxSecondFactorFailures)); err != nil {
+			return err
+		}
+	case err == nil:
+		return ResetLogin(db, key)
+	}
+	return err
+}
+
+func verifySecondFactor(db *gorm.DB, userID uint, code string) error {
+	code = strings.TrimSpace(code)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if !user.TOTPEnabled {
+			return ErrTOTPNotEnrolled
+		}
+
+		if step, ok := validateTOTP(user.TOTPSecret, code, time.Now()); ok {
+			if step <= user.TOTPLastCounter {
+				return ErrInvalidCode
+			}
+			return tx.Model(&user).Update("totp_last_counter", step).Error
+		}
+
+		result := tx.Model(&model.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(code))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	})
+}
+
+// CreateLoginChallenge returns an opaque token proving the password step of login succeeded
+func CreateLoginChallenge(db *gorm.DB, userID uint) (string, time.Time, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(challengeTTL)
+	err = db.Create(&model.LoginChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: expiresAt,
+	}).Error
+	return token, expiresAt, err
+}
+
+// CompleteLoginChallenge verifies the second factor for a login challenge and returns its user.
+// Wrong codes count as failed logins of the user, whose failures are only cleared here.
+func CompleteLoginChallenge(db *gorm.DB, token, code, ip string) (*model.User, error) {
+	var challenge model.LoginChallenge
+	if err := db.Where("token_hash = ?", hashToken(token)).First(&challenge).Error; err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= maxChallengeAttempts {
+		return nil, ErrInvalidChallenge
+	}
+
+	loginKey := UserThrottleKey(challenge.UserID)
+	if err := CheckLogin(db, loginKey, IPThrottleKey(ip)); err != nil {
+		return nil, err
+	}
+
+	if err := VerifySecondFactor(db, challenge.UserID, code); err != nil {
+		db.Model(&challenge).Update("attempts", gorm.Expr("attempts + 1"))
+		if errors.Is(err, ErrInvalidCode) {
+			if err := RecordLoginFailure(db, loginKey, &challenge.UserID, ip); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	// Only one request may complete the challenge
+	result := db.Model(&model.LoginChallenge{}).
+		Where("id = ? AND used_at IS NULL", challenge.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidChallenge
+	}
+	if err := ResetLogin(db, loginKey); err != nil {
+		return nil, err
+	}
+
+	var user model.User
+	if err := db.First(&user, challenge.UserID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(b)
+		code := raw[:5] + "-" + raw[5:]
+
+		if err := tx.Create(&model.RecoveryCode{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PasswordResetTTL     = time.Hour
+	EmailVerificationTTL = 48 * time.Hour
+)
+
+var ErrInvalidUserToken = errors.New("invalid or expired token")
+
+// IssueUserToken creates a signed single-use token for a password reset or email verification.
+// Older unused tokens of the same purpose stop working.
+func IssueUserToken(db *gorm.DB, userID uint, purpose model.TokenPurpose, email string, ttl time.Duration) (string, error) {
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	token := nonce + "." + signUserToken(purpose, nonce)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			Email:     email,
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken checks the signature and expiry of a token and marks it used.
+// It must be called inside the database transaction that acts on the token.
+func ConsumeUserToken(tx *gorm.DB, token string, purpose model.TokenPurpose) (*model.UserToken, error) {
+	nonce, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signUserToken(purpose, nonce))) {
+		return nil, ErrInvalidUserToken
+	}
+
+	var stored model.UserToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&stored).Error; err != nil {
+		return nil, ErrInvalidUserToken
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+
+	result := tx.Model(&model.UserToken{}).
+		Where("id = ? AND used_at IS NULL", stored.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidUserToken
+	}
+	return &stored, nil
+}
+
+// signUserToken binds a token to its purpose so it cannot be used for another flow
+func signUserToken(purpose model.TokenPurpose, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(config.Config("SECRET")))
+	mac.Write([]byte(string(purpose) + ":" + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
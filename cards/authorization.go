@@ -0,0 +1,509 @@
+package cards
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/encryption"
+	"github.com/denver-code/moza-backend/fx"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/payment"
+	"github.com/denver-code/moza-backend/util"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// LimitWindow is the rolling period the daily limit of a card applies to
+	LimitWindow = 24 * time.Hour
+	// DefaultHoldTTL is how long an approved authorization holds funds unless captured
+	DefaultHoldTTL = 7 * 24 * time.Hour
+	// DefaultMaxDetailFailures is how many wrong expiry dates or CVVs freeze a card
+	// unless CARD_MAX_DETAIL_FAILURES is set
+	DefaultMaxDetailFailures = 3
+)
+
+var (
+	ErrUnknownCard           = errors.New("card number not recognised")
+	ErrInvalidAmount         = errors.New("amount must be positive")
+	ErrUnsupportedCurrency   = errors.New("unsupported currency")
+	ErrMerchantRequired      = errors.New("merchant name is required")
+	ErrInvalidMCC            = errors.New("merchant category code must be four digits")
+	ErrAuthorizationNotFound = errors.New("authorization not found")
+	ErrAuthorizationNotOpen  = errors.New("authorization was already captured, released or declined")
+	ErrCaptureExceedsHold    = errors.New("capture amount exceeds the authorized amount")
+	ErrAuthorizationExpired  = errors.New("authorization hold has expired")
+)
+
+// HoldTTL returns how long approved authorizations hold funds, from CARD_HOLD_TTL
+func HoldTTL() time.Duration {
+	d, err := time.ParseDuration(config.Config("CARD_HOLD_TTL"))
+	if err != nil || d <= 0 {
+		return DefaultHoldTTL
+	}
+	return d
+}
+
+// MaxDetailFailures returns how many wrong expiry dates or CVVs since the last
+// approval freeze a card
+func MaxDetailFailures() int {
+	n, err := strconv.Atoi(config.Config("CARD_MAX_DETAIL_FAILURES"))
+	if err != nil || n <= 0 {
+		return DefaultMaxDetailFailures
+	}
+	return n
+}
+
+// AuthorizationRequest is what a merchant sends through the card network to charge a card
+type AuthorizationRequest struct {
+	CardNumber   string
+	Expiry       string // MM/YY as printed on the card
+	CVV          string
+	Amount       money.Amount // in minor units of Currency
+	Currency     model.Currency
+	MerchantName string
+	MCC          string
+}
+
+func (req *AuthorizationRequest) validate() error {
+	req.MerchantName = strings.TrimSpace(req.MerchantName)
+	switch {
+	case req.Amount <= 0:
+		return ErrInvalidAmount
+	case !req.Currency.Valid():
+		return ErrUnsupportedCurrency
+	case req.MerchantName == "":
+		return ErrMerchantRequired
+	case !validMCC(req.MCC):
+		return ErrInvalidMCC
+	}
+	return nil
+}
+
+// Authorize decides whether a card may be charged. Declines are recorded and
+// returned with a reason rather than as an error. An approval holds the billing
+// amount on the account for an AUTHORISED transaction until it is captured,
+// released or the hold expires. Too many wrong expiry dates or CVVs freeze the card.
+func Authorize(db *gorm.DB, req AuthorizationRequest) (*model.CardAuthorization, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	if !ValidNumber(req.CardNumber) {
+		return nil, ErrUnknownCard
+	}
+
+	found, err := findByNumber(db, req.CardNumber)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownCard
+		}
+		return nil, err
+	}
+
+	var auth *model.CardAuthorization
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lock the account, then the card, so concurrent charges see each other's holds
+		accounts, err := ledger.LockAccounts(tx, found.BankAccountID)
+		if err != nil {
+			return err
+		}
+		// Deleted accounts are not returned by the lock
+		account, ok := accounts[found.BankAccountID]
+		if !ok {
+			return ErrAccountInactive
+		}
+
+		var card model.Card
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, found.ID).Error; err != nil {
+			return err
+		}
+
+		auth = &model.CardAuthorization{
+			CardID:          card.ID,
+			BankAccountID:   account.ID,
+			Amount:          req.Amount,
+			Currency:        req.Currency,
+			BillingCurrency: account.Currency,
+			MerchantName:    req.MerchantName,
+			MCC:             req.MCC,
+		}
+
+		reason, err := decide(tx, &card, account, req, auth)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			auth.Status = model.AUTH_DECLINED
+			auth.DeclineReason = reason
+			if err := tx.Create(auth).Error; err != nil {
+				return err
+			}
+			if reason == model.DECLINE_INVALID_EXPIRY || reason == model.DECLINE_INVALID_CVV {
+				return freezeAfterWrongDetails(tx, &card)
+			}
+			return nil
+		}
+
+		transaction := &model.Transaction{
+			FromAccountID:    &account.ID,
+			Amount:           auth.BillingAmount,
+			Currency:         account.Currency,
+			ToAmount:         auth.BillingAmount,
+			ToCurrency:       account.Currency,
+			Description:      req.MerchantName,
+			Type:             model.CARD_PAYMENT,
+			Status:           model.PENDING,
+			Reference:        util.GenerateTransactionReference(),
+			CounterpartyName: req.MerchantName,
+		}
+		if err := tx.Create(transaction).Error; err != nil {
+			return err
+		}
+		if err := payment.Transition(tx, transaction, model.AUTHORISED, ""); err != nil {
+			return err
+		}
+
+		hold, err := holds.Place(tx, account, holds.Request{
+			Kind:          model.HOLD_CARD_AUTHORIZATION,
+			Amount:        auth.BillingAmount,
+			Description:   req.MerchantName,
+			ExpiresAt:     time.Now().Add(HoldTTL()),
+			TransactionID: &transaction.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if auth.AuthCode, err = authCode(); err != nil {
+			return err
+		}
+		auth.Status = model.AUTH_APPROVED
+		auth.TransactionID = &transaction.ID
+		auth.HoldID = &hold.ID
+		return tx.Create(auth).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// freezeAfterWrongDetails freezes a card once it has been declined for a wrong expiry
+// date or CVV too often in the limit window since its last approval, so neither can be
+// guessed. The freeze is placed as staff so the holder cannot lift it alone.
+func freezeAfterWrongDetails(tx *gorm.DB, card *model.Card) error {
+	since := time.Now().Add(-LimitWindow)
+	var lastApproval model.CardAuthorization
+	err := tx.Where("card_id = ? AND status <> ?", card.ID, model.AUTH_DECLINED).
+		Order("created_at DESC").First(&lastApproval).Error
+	switch {
+	case err == nil && lastApproval.CreatedAt.After(since):
+		since = lastApproval.CreatedAt
+	case err == nil:
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	var failures int64
+	if err := tx.Model(&model.CardAuthorization{}).
+		Where("card_id = ? AND decline_reason IN ? AND created_at > ?", card.ID,
+			[]model.DeclineReason{model.DECLINE_INVALID_EXPIRY, model.DECLINE_INVALID_CVV}, since).
+		Count(&failures).Error; err != nil {
+		return err
+	}
+	if failures < int64(MaxDetailFailures()) {
+		return nil
+	}
+
+	now := time.Now()
+	card.Status = model.CARD_FROZEN
+	card.IsActive = false
+	card.FrozenAt = &now
+	card.FrozenByStaff = true
+	return tx.Save(card).Error
+}
+
+// decide runs the authorization checks in order and returns the first decline reason,
+// filling in the billing amount on the way
+func decide(tx *gorm.DB, card *model.Card, account *model.BankAccount, req AuthorizationRequest, auth *model.CardAuthorization) (model.DeclineReason, error) {
+	if card.Status != model.CARD_ACTIVE {
+		return model.DECLINE_CARD_INACTIVE, nil
+	}
+	if account.Status != model.ACCOUNT_ACTIVE {
+		return model.DECLINE_ACCOUNT_INACTIVE, nil
+	}
+
+	month, year, ok := parseExpiry(req.Expiry)
+	if !ok || month != int(card.ExpiryDate.Month()) || year != card.ExpiryDate.Year()%100 {
+		return model.DECLINE_INVALID_EXPIRY, nil
+	}
+	// Cards are valid until the end of their expiry month
+	if !time.Now().Before(endOfMonth(card.ExpiryDate)) {
+		return model.DECLINE_EXPIRED_CARD, nil
+	}
+
+	cvv, err := encryption.Open(card.EncryptedCVV, cvvContext)
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(req.CVV), []byte(cvv)) != 1 {
+		return model.DECLINE_INVALID_CVV, nil
+	}
+
+	auth.BillingAmount = req.Amount
+	if req.Currency != account.Currency {
+		conversion, err := fx.Convert(tx, req.Amount, req.Currency, account.Currency)
+		if err != nil || conversion.ToAmount <= 0 {
+			return model.DECLINE_CURRENCY, nil
+		}
+		auth.BillingAmount = conversion.ToAmount
+	}
+
+	if card.DailyLimit > 0 {
+		var spent money.Amount
+		if err := tx.Model(&model.CardAuthorization{}).
+			Where("card_id = ? AND status IN ? AND created_at > ?", card.ID,
+				[]model.AuthorizationStatus{model.AUTH_APPROVED, model.AUTH_CAPTURED}, time.Now().Add(-LimitWindow)).
+			Select("COALESCE(SUM(CASE WHEN status = ? THEN captured_billing_amount ELSE billing_amount END), 0)", model.AUTH_CAPTURED).
+			Scan(&spent).Error; err != nil {
+			return "", err
+		}
+		if spent+auth.BillingAmount > card.DailyLimit {
+			return model.DECLINE_LIMIT_EXCEEDED, nil
+		}
+	}
+
+	available, err := holds.Available(tx, account)
+	if err != nil {
+		return "", err
+	}
+	if available < auth.BillingAmount {
+		return model.DECLINE_INSUFFICIENT_FUNDS, nil
+	}
+
+	return "", nil
+}
+
+// CaptureRequest settles an approved authorization
+type CaptureRequest struct {
+	AuthorizationID uint
+	Amount          money.Amount // in minor units of the authorization currency, 0 captures it in full
+}
+
+// Capture turns the hold of an approved authorization into a completed card payment.
+// A partial capture charges a proportional share of the held billing amount and
+// releases the rest.
+func Capture(db *gorm.DB, req CaptureRequest) (*model.CardAuthorization, *model.Transaction, error) {
+	if req.Amount < 0 {
+		return nil, nil, ErrInvalidAmount
+	}
+
+	var auth *model.CardAuthorization
+	var transaction model.Transaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var hold *model.Hold
+		var err error
+		if auth, hold, err = lockAuthorization(tx, req.AuthorizationID); err != nil {
+			return err
+		}
+
+		amount := req.Amount
+		if amount == 0 {
+			amount = auth.Amount
+		}
+		if amount > auth.Amount {
+			return ErrCaptureExceedsHold
+		}
+		billing := prorate(auth.BillingAmount, amount, auth.Amount)
+
+		if err := tx.First(&transaction, *auth.TransactionID).Error; err != nil {
+			return err
+		}
+		transaction.Amount = billing
+		transaction.ToAmount = billing
+		if err := tx.Model(&transaction).Updates(map[string]any{"amount": billing, "to_amount": billing}).Error; err != nil {
+			return err
+		}
+
+		// Free the hold before posting so the payment is made from the funds it reserved
+		if err := holds.Finish(tx, hold, model.HOLD_CAPTURED); err != nil {
+			return err
+		}
+		if billing > 0 {
+			entry := ledger.CardPayment(auth.BankAccountID, billing, auth.BillingCurrency, transaction.Reference)
+			entry.TransactionID = &transaction.ID
+			if err := ledger.Post(tx, entry); err != nil {
+				return err
+			}
+		}
+		if err := payment.Transition(tx, &transaction, model.COMPLETED, ""); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		auth.Status = model.AUTH_CAPTURED
+		auth.CapturedAmount = amount
+		auth.CapturedBillingAmount = billing
+		auth.CapturedAt = &now
+		return tx.Save(auth).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth, &transaction, nil
+}
+
+// Release cancels an approved authorization the merchant will not capture, or that
+// staff reverse, which frees the held funds. Reason is recorded on its transaction.
+func Release(db *gorm.DB, authorizationID uint, reason string) (*model.CardAuthorization, error) {
+	var auth *model.CardAuthorization
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var hold *model.Hold
+		var err error
+		if auth, hold, err = lockAuthorization(tx, authorizationID); err != nil {
+			return err
+		}
+		if err := holds.Finish(tx, hold, model.HOLD_RELEASED); err != nil {
+			return err
+		}
+		return closeAuthorization(tx, auth, model.AUTH_RELEASED, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// ExpireAuthorization closes the authorization of an expired card hold and
+// reverses its transaction. It is registered with holds.OnExpire.
+func ExpireAuthorization(tx *gorm.DB, hold *model.Hold) error {
+	var auth model.CardAuthorization
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("hold_id = ? AND status = ?", hold.ID, model.AUTH_APPROVED).
+		First(&auth).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return closeAuthorization(tx, &auth, model.AUTH_EXPIRED, "authorization expired")
+}
+
+// closeAuthorization ends an approved authorization without a payment
+func closeAuthorization(tx *gorm.DB, auth *model.CardAuthorization, status model.AuthorizationStatus, reason string) error {
+	var transaction model.Transaction
+	if err := tx.First(&transaction, *auth.TransactionID).Error; err != nil {
+		return err
+	}
+	if err := payment.Transition(tx, &transaction, model.REVERSED, reason); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	auth.Status = status
+	auth.ReleasedAt = &now
+	return tx.Save(auth).Error
+}
+
+// lockAuthorization locks an approved authorization and its hold. The account is
+// locked first, in the same order as the hold expiry job.
+func lockAuthorization(tx *gorm.DB, id uint) (*model.CardAuthorization, *model.Hold, error) {
+	var found model.CardAuthorization
+	if err := tx.First(&found, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrAuthorizationNotFound
+		}
+		return nil, nil, err
+	}
+
+	accounts, err := ledger.LockAccounts(tx, found.BankAccountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Frozen accounts still settle what was authorized before the freeze
+	account, ok := accounts[found.BankAccountID]
+	if !ok || account.Status == model.ACCOUNT_CLOSED {
+		return nil, nil, ErrAccountInactive
+	}
+
+	var auth model.CardAuthorization
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&auth, id).Error; err != nil {
+		return nil, nil, err
+	}
+	if auth.Status != model.AUTH_APPROVED || auth.HoldID == nil {
+		return nil, nil, ErrAuthorizationNotOpen
+	}
+
+	hold, err := holds.Lock(tx, *auth.HoldID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Left for the expiry job, which reverses the transaction
+	if !hold.ExpiresAt.After(time.Now()) {
+		return nil, nil, ErrAuthorizationExpired
+	}
+	return &auth, hold, nil
+}
+
+// prorate returns the share part/whole of total, rounded down
+func prorate(total, part, whole money.Amount) money.Amount {
+	if part == whole {
+		return total
+	}
+	n := new(big.Int).Mul(big.NewInt(int64(total)), big.NewInt(int64(part)))
+	return money.Amount(n.Quo(n, big.NewInt(int64(whole))).Int64())
+}
+
+// parseExpiry reads an MM/YY expiry date
+func parseExpiry(s string) (month, year int, ok bool) {
+	mm, yy, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found || len(mm) != 2 || len(yy) != 2 {
+		return 0, 0, false
+	}
+	month, err := strconv.Atoi(mm)
+	if err != nil || month < 1 || month > 12 {
+		return 0, 0, false
+	}
+	year, err = strconv.Atoi(yy)
+	if err != nil || year < 0 {
+		return 0, 0, false
+	}
+	return month, year, true
+}
+
+func endOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+}
+
+func validMCC(mcc string) bool {
+	if len(mcc) != 4 {
+		return false
+	}
+	for _, r := range mcc {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// authCode returns a random six digit approval code
+func authCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
@@ -0,0 +1,309 @@
+package cards
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/money"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Validity is how long a newly issued card stays valid
+const Validity = 4 * 365 * 24 * time.Hour
+
+var (
+	ErrCardNotFound     = errors.New("card not found or unauthorized")
+	ErrCardFrozen       = errors.New("card is frozen")
+	ErrCardCancelled    = errors.New("card is cancelled")
+	ErrCardNotFrozen    = errors.New("card is not frozen")
+	ErrFrozenByStaff    = errors.New("card was frozen by staff")
+	ErrCancelledByStaff = errors.New("card was cancelled by staff")
+	ErrAlreadyReplaced  = errors.New("card was already replaced")
+	ErrInvalidReason    = errors.New("invalid cancellation reason")
+	ErrAccountNotFound  = errors.New("bank account not found or unauthorized")
+	ErrAccountInactive  = errors.New("bank account is frozen or closed")
+	ErrInvalidLimit     = errors.New("daily limit cannot be negative")
+)
+
+// IssueRequest describes a new card for one of the user's accounts
+type IssueRequest struct {
+	UserID        uint
+	BankAccountID uint
+	CardType      string       // one of Schemes
+	DailyLimit    money.Amount // in minor units of the account currency
+}
+
+// Issue creates a card for an active account owned by the user
+func Issue(db *gorm.DB, req IssueRequest) (*model.Card, error) {
+	if req.DailyLimit < 0 {
+		return nil, ErrInvalidLimit
+	}
+	scheme, err := LookupScheme(req.CardType)
+	if err != nil {
+		return nil, err
+	}
+
+	var account model.BankAccount
+	if err := db.Where("id = ? AND user_id = ?", req.BankAccountID, req.UserID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+	if account.Status != model.ACCOUNT_ACTIVE {
+		return nil, ErrAccountInactive
+	}
+
+	var card *model.Card
+	err = db.Transaction(func(tx *gorm.DB) error {
+		card, err = createCard(tx, req.UserID, account.ID, scheme, req.DailyLimit, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// createCard issues an active card with a fresh number, expiry date and CVV. A
+// concurrent issue can take the same number between the check and the insert, the
+// insert then runs in a savepoint so another number can be drawn.
+func createCard(tx *gorm.DB, userID, accountID uint, scheme Scheme, dailyLimit money.Amount, replaces *uint) (*model.Card, error) {
+	for range MaxNumberAttempts {
+		card, err := newCard(tx, userID, accountID, scheme, dailyLimit)
+		if err != nil {
+			return nil, err
+		}
+		card.ReplacesCardID = replaces
+
+		err = tx.Transaction(func(tx *gorm.DB) error {
+			return tx.Create(card).Error
+		})
+		if err == nil {
+			return card, nil
+		}
+		if !numberTaken(err) {
+			return nil, err
+		}
+	}
+	return nil, ErrNumbersExhausted
+}
+
+// numberTaken reports whether an insert failed on the unique index of card numbers
+func numberTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && strings.Contains(pgErr.ConstraintName, "number_hash")
+}
+
+// newCard builds an active card with a fresh number, expiry date and CVV
+func newCard(tx *gorm.DB, userID, accountID uint, scheme Scheme, dailyLimit money.Amount) (*model.Card, error) {
+	number, err := newNumber(tx, scheme)
+	if err != nil {
+		return nil, err
+	}
+	cvv, err := newCVV(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	card := &model.Card{
+		UserID:        userID,
+		BankAccountID: accountID,
+		CardNumber:    number,
+		ExpiryDate:    time.Now().Add(Validity),
+		CVV:           cvv,
+		Status:        model.CARD_ACTIVE,
+		IsActive:      true,
+		DailyLimit:    dailyLimit,
+		CardType:      scheme.Name,
+	}
+	if err := sealDetails(card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// Request describes a lifecycle change of a card
+type Request struct {
+	ActorID uint // the card holder, or a member of staff when Staff is set
+	CardID  uint
+	Staff   bool // staff may act on any card
+
+	Reason model.CardCancelReason // cancellation and replacement only
+	Note   string
+}
+
+// lockCard loads a card the actor may change with SELECT ... FOR UPDATE
+func lockCard(tx *gorm.DB, req Request) (*model.Card, error) {
+	var card model.Card
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, req.CardID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCardNotFound
+		}
+		return nil, err
+	}
+	if !req.Staff && card.UserID != req.ActorID {
+		return nil, ErrCardNotFound
+	}
+	return &card, nil
+}
+
+// Freeze temporarily blocks a card. Staff may take over a freeze the holder
+// placed, so only staff can lift it.
+func Freeze(db *gorm.DB, req Request) (*model.Card, error) {
+	var card *model.Card
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if card, err = lockCard(tx, req); err != nil {
+			return err
+		}
+
+		switch {
+		case card.Status == model.CARD_CANCELLED:
+			return ErrCardCancelled
+		case card.Status == model.CARD_FROZEN && (!req.Staff || card.FrozenByStaff):
+			return ErrCardFrozen
+		}
+
+		now := time.Now()
+		card.Status = model.CARD_FROZEN
+		card.IsActive = false
+		card.FrozenAt = &now
+		card.FrozenByStaff = req.Staff
+		return tx.Save(card).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// Unfreeze lifts a freeze, holders cannot lift a freeze placed by staff
+func Unfreeze(db *gorm.DB, req Request) (*model.Card, error) {
+	var card *model.Card
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if card, err = lockCard(tx, req); err != nil {
+			return err
+		}
+
+		if card.Status != model.CARD_FROZEN {
+			return ErrCardNotFrozen
+		}
+		if card.FrozenByStaff && !req.Staff {
+			return ErrFrozenByStaff
+		}
+
+		card.Status = model.CARD_ACTIVE
+		card.IsActive = true
+		card.FrozenAt = nil
+		card.FrozenByStaff = false
+		return tx.Save(card).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// Cancel permanently blocks a card, for example when it was lost or stolen
+func Cancel(db *gorm.DB, req Request) (*model.Card, error) {
+	if !validReason(req.Reason) {
+		return nil, ErrInvalidReason
+	}
+
+	var card *model.Card
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if card, err = lockCard(tx, req); err != nil {
+			return err
+		}
+		if card.Status == model.CARD_CANCELLED {
+			return ErrCardCancelled
+		}
+		cancel(card, req)
+		return tx.Save(card).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// Replace issues a new card with a new number, expiry date and CVV on the same
+// account, keeping the type and daily limit of the old card. The old card is
+// cancelled with the given reason unless it already was, and both are linked.
+func Replace(db *gorm.DB, req Request) (old *model.Card, replacement *model.Card, err error) {
+	if !validReason(req.Reason) {
+		return nil, nil, ErrInvalidReason
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if old, err = lockCard(tx, req); err != nil {
+			return err
+		}
+		if old.ReplacedByCardID != nil {
+			return ErrAlreadyReplaced
+		}
+		if old.FrozenByStaff && !req.Staff {
+			return ErrFrozenByStaff
+		}
+		if old.CancelledByStaff && !req.Staff {
+			return ErrCancelledByStaff
+		}
+
+		var account model.BankAccount
+		if err := tx.First(&account, old.BankAccountID).Error; err != nil {
+			return err
+		}
+		if account.Status != model.ACCOUNT_ACTIVE {
+			return ErrAccountInactive
+		}
+
+		// Cards issued before types were validated are replaced on the default scheme
+		scheme, err := LookupScheme(old.CardType)
+		if err != nil {
+			if scheme, err = LookupScheme(DefaultScheme); err != nil {
+				return err
+			}
+		}
+		if replacement, err = createCard(tx, old.UserID, old.BankAccountID, scheme, old.DailyLimit, &old.ID); err != nil {
+			return err
+		}
+
+		if old.Status != model.CARD_CANCELLED {
+			cancel(old, req)
+		}
+		old.ReplacedByCardID = &replacement.ID
+		return tx.Save(old).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return old, replacement, nil
+}
+
+func cancel(card *model.Card, req Request) {
+	now := time.Now()
+	card.Status = model.CARD_CANCELLED
+	card.IsActive = false
+	card.FrozenAt = nil
+	// FrozenByStaff is kept so a holder cannot replace the card to get around the freeze
+	card.CancelledAt = &now
+	card.CancelledByStaff = req.Staff
+	card.CancelReason = req.Reason
+	card.CancelNote = strings.TrimSpace(req.Note)
+}
+
+func validReason(reason model.CardCancelReason) bool {
+	switch reason {
+	case model.CARD_LOST, model.CARD_STOLEN, model.CARD_DAMAGED, model.CARD_EXPIRED, model.CARD_OTHER:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package cards
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/encryption"
+
+	"gorm.io/gorm"
+)
+
+// Contexts the card number and CVV are encrypted under
+const (
+	numberContext = "card.number"
+	cvvContext    = "card.cvv"
+)
+
+// sealDetails stores the plaintext number and CVV of a card encrypted, along with
+// the masked number and the hash used to look it up
+func sealDetails(card *model.Card) error {
+	number, err := encryption.Seal(card.CardNumber, numberContext)
+	if err != nil {
+		return err
+	}
+	cvv, err := encryption.Seal(card.CVV, cvvContext)
+	if err != nil {
+		return err
+	}
+
+	card.EncryptedNumber = number
+	card.EncryptedCVV = cvv
+	card.NumberHash = encryption.Hash(card.CardNumber)
+	card.MaskedNumber = MaskNumber(card.CardNumber)
+	return nil
+}
+
+// openDetails decrypts the number and CVV of a card into its plaintext fields
+func openDetails(card *model.Card) error {
+	number, err := encryption.Open(card.EncryptedNumber, numberContext)
+	if err != nil {
+		return err
+	}
+	cvv, err := encryption.Open(card.EncryptedCVV, cvvContext)
+	if err != nil {
+		return err
+	}
+
+	card.CardNumber = number
+	card.CVV = cvv
+	return nil
+}
+
+// MaskNumber keeps the first six and last four digits of a card number
+func MaskNumber(number string) string {
+	if len(number) <= 10 {
+		return strings.Repeat("*", len(number))
+	}
+	return number[:6] + strings.Repeat("*", len(number)-10) + number[len(number)-4:]
+}
+
+// findByNumber looks a card up by the hash of its number
+func findByNumber(db *gorm.DB, number string) (*model.Card, error) {
+	var card model.Card
+	if err := db.Where("number_hash = ?", encryption.Hash(number)).First(&card).Error; err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// Reveal returns one of the user's cards with its full number and CVV decrypted
+func Reveal(db *gorm.DB, userID, cardID uint) (*model.Card, error) {
+	var card model.Card
+	if err := db.Where("id = ? AND user_id = ?", cardID, userID).First(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCardNotFound
+		}
+		return nil, err
+	}
+	if card.Status == model.CARD_CANCELLED {
+		return nil, ErrCardCancelled
+	}
+
+	if err := openDetails(&card); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
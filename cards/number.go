@@ -0,0 +1,242 @@
+package cards
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/encryption"
+
+	"gorm.io/gorm"
+)
+
+// MaxNumberAttempts bounds how many numbers are drawn before giving up on a
+// BIN range that is nearly exhausted
+const MaxNumberAttempts = 10
+
+var (
+	ErrInvalidCardType  = errors.New("unsupported card type")
+	ErrNumbersExhausted = errors.New("could not find an unused card number")
+	ErrInvalidBINRanges = errors.New("invalid CARD_BIN_RANGES")
+)
+
+// Scheme is a card network we issue cards on
+type Scheme struct {
+	Name   string     `json:"name"`
+	Length int        `json:"length"` // digits of a card number including the check digit
+	BINs   []BINRange `json:"bins"`
+}
+
+// BINRange is an inclusive range of six digit bank identification numbers
+type BINRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// DefaultScheme is used for replacements of cards issued before types were validated
+const DefaultScheme = "VISA"
+
+// schemes holds the BIN ranges cards are issued from, CARD_BIN_RANGES overrides them
+var schemes = map[string]Scheme{
+	"VISA":       {Name: "VISA", Length: 16, BINs: []BINRange{{From: 453200, To: 453299}}},
+	"MASTERCARD": {Name: "MASTERCARD", Length: 16, BINs: []BINRange{{From: 535500, To: 535599}}},
+	"AMEX":       {Name: "AMEX", Length: 15, BINs: []BINRange{{From: 374200, To: 374299}}},
+	"DISCOVER":   {Name: "DISCOVER", Length: 16, BINs: []BINRange{{From: 601100, To: 601199}}},
+}
+
+// schemeLengths lists the card number length of each scheme we know how to issue
+var schemeLengths = map[string]int{"VISA": 16, "MASTERCARD": 16, "AMEX": 15, "DISCOVER": 16}
+
+// SetupSchemes reads the BIN ranges to issue from, in the form
+// VISA=400000-400999;MASTERCARD=510000-510999,222100-222199
+func SetupSchemes() error {
+	value := strings.TrimSpace(config.Config("CARD_BIN_RANGES"))
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := parseBINRanges(value)
+	if err != nil {
+		return err
+	}
+	schemes = parsed
+	log.Printf("Card schemes: %s", strings.Join(Schemes(), ", "))
+	return nil
+}
+
+func parseBINRanges(value string) (map[string]Scheme, error) {
+	parsed := map[string]Scheme{}
+	for _, part := range strings.Split(value, ";") {
+		name, ranges, ok := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		length, known := schemeLengths[name]
+		if !ok || !known {
+			return nil, fmt.Errorf("%w: unknown scheme %q", ErrInvalidBINRanges, name)
+		}
+
+		scheme := Scheme{Name: name, Length: length}
+		for _, r := range strings.Split(ranges, ",") {
+			from, to, _ := strings.Cut(strings.TrimSpace(r), "-")
+			if to == "" {
+				to = from
+			}
+			lo, err1 := parseBIN(from)
+			hi, err2 := parseBIN(to)
+			if err1 != nil || err2 != nil || lo > hi {
+				return nil, fmt.Errorf("%w: bad range %q for %s", ErrInvalidBINRanges, r, name)
+			}
+			scheme.BINs = append(scheme.BINs, BINRange{From: lo, To: hi})
+		}
+		parsed[name] = scheme
+	}
+	return parsed, nil
+}
+
+// parseBIN reads a BIN of exactly six ASCII digits, leading zeros included
+func parseBIN(s string) (int, error) {
+	if len(s) != 6 {
+		return 0, ErrInvalidBINRanges
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, ErrInvalidBINRanges
+		}
+	}
+	return strconv.Atoi(s)
+}
+
+// Schemes returns the names of the schemes cards can be issued on
+func Schemes() []string {
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupScheme returns the scheme of a card type, ignoring case
+func LookupScheme(cardType string) (Scheme, error) {
+	scheme, ok := schemes[strings.ToUpper(strings.TrimSpace(cardType))]
+	if !ok {
+		return Scheme{}, ErrInvalidCardType
+	}
+	return scheme, nil
+}
+
+// newNumber draws Luhn valid card numbers from the scheme's BIN ranges until
+// one is not yet used by another card
+func newNumber(tx *gorm.DB, scheme Scheme) (string, error) {
+	for range MaxNumberAttempts {
+		number, err := drawNumber(scheme)
+		if err != nil {
+			return "", err
+		}
+
+		var count int64
+		if err := tx.Unscoped().Model(&model.Card{}).Where("number_hash = ?", encryption.Hash(number)).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return number, nil
+		}
+	}
+	return "", ErrNumbersExhausted
+}
+
+// drawNumber picks a random BIN from the scheme's ranges, weighted by their size,
+// fills in random account digits and appends the Luhn check digit
+func drawNumber(scheme Scheme) (string, error) {
+	total := 0
+	for _, r := range scheme.BINs {
+		total += r.To - r.From + 1
+	}
+	n, err := randomInt(total)
+	if err != nil {
+		return "", err
+	}
+	bin := 0
+	for _, r := range scheme.BINs {
+		if size := r.To - r.From + 1; n >= size {
+			n -= size
+			continue
+		}
+		bin = r.From + n
+		break
+	}
+
+	prefix := fmt.Sprintf("%06d", bin)
+	digits, err := randomDigits(scheme.Length - 1 - len(prefix))
+	if err != nil {
+		return "", err
+	}
+	payload := prefix + digits
+	return payload + string(luhnDigit(payload)), nil
+}
+
+// newCVV returns a random security code, four digits for AMEX and three otherwise
+func newCVV(scheme Scheme) (string, error) {
+	if scheme.Name == "AMEX" {
+		return randomDigits(4)
+	}
+	return randomDigits(3)
+}
+
+// randomDigits returns n random decimal digits
+func randomDigits(n int) (string, error) {
+	var b strings.Builder
+	for range n {
+		digit, err := randomInt(10)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(byte('0' + digit))
+	}
+	return b.String(), nil
+}
+
+func randomInt(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
+}
+
+// luhnDigit returns the check digit that makes payload followed by it Luhn valid
+func luhnDigit(payload string) byte {
+	sum := 0
+	double := true // the check digit is not doubled, so the last payload digit is
+	for i := len(payload) - 1; i >= 0; i-- {
+		d := int(payload[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// ValidNumber reports whether a card number consists of 12 to 19 digits with a valid Luhn check digit
+func ValidNumber(number string) bool {
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return luhnDigit(number[:len(number)-1]) == number[len(number)-1]
+}
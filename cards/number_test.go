@@ -0,0 +1,67 @@
+package cards
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLuhnDigit(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    byte
+	}{
+		{"7992739871", '3'},
+		{"411111111111111", '1'},
+		{"37828224631000", '5'},
+		{"0", '0'},
+	}
+	for _, tt := range tests {
+		if got := luhnDigit(tt.payload); got != tt.want {
+			t.Errorf("luhnDigit(%q) = %c, want %c", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestValidNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"378282246310005", true},
+		{"4111111111111112", false},
+		{"41111111111", false},          // too short
+		{"41111111111111111111", false}, // too long
+		{"4111 1111 1111 1111", false},
+		{"411111111111111a", false},
+	}
+	for _, tt := range tests {
+		if got := ValidNumber(tt.number); got != tt.want {
+			t.Errorf("ValidNumber(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestParseBIN(t *testing.T) {
+	for _, bad := range []string{"-12345", "+12345", "12345", "1234567", "12a456", ""} {
+		if _, err := parseBIN(bad); err == nil {
+			t.Errorf("parseBIN(%q) accepted an invalid BIN", bad)
+		}
+	}
+	if bin, err := parseBIN("012345"); err != nil || bin != 12345 {
+		t.Errorf("parseBIN(%q) = %d, %v", "012345", bin, err)
+	}
+}
+
+func TestDrawNumber(t *testing.T) {
+	scheme := Scheme{Name: "VISA", Length: 16, BINs: []BINRange{{From: 12345, To: 12345}}}
+	for range 100 {
+		number, err := drawNumber(scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(number) != scheme.Length || !strings.HasPrefix(number, "012345") || !ValidNumber(number) {
+			t.Fatalf("drawNumber returned %q", number)
+		}
+	}
+}
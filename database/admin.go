@@ -0,0 +1,19 @@
+package database
+
+import (
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+)
+
+// PromoteAdmin gives the user registered with ADMIN_EMAIL the admin role, so the
+// first operator can sign in to the admin API and grant roles to others. The address
+// must be verified, otherwise whoever registers it first would become admin.
+func PromoteAdmin() error {
+	email := config.Config("ADMIN_EMAIL")
+	if email == "" {
+		return nil
+	}
+	return DB.Model(&model.User{}).
+		Where("email = ? AND email_verified = true AND role <> ?", email, model.ROLE_ADMIN).
+		Update("role", model.ROLE_ADMIN).Error
+}
@@ -27,11 +27,53 @@ func ConnectDB() {
 	}
 
 	fmt.Println("Connection Opened to Database")
+	if err := migrateMinorUnits(DB); err != nil {
+		panic("failed to migrate money columns to minor units")
+	}
 	DB.AutoMigrate(
 		&model.User{},
 		&model.BankAccount{},
 		&model.Card{},
 		&model.Transaction{},
+		&model.JournalEntry{},
+		&model.Posting{},
+		&model.ExchangeRate{},
+		&model.FXQuote{},
+		&model.IdempotencyKey{},
+		&model.Pot{},
+		&model.ScheduledPayment{},
+		&model.Session{},
+		&model.RefreshToken{},
+		&model.RevokedToken{},
+		&model.RecoveryCode{},
+		&model.LoginChallenge{},
+		&model.UserToken{},
+		&model.LoginThrottle{},
+		&model.LockoutEvent{},
+		&model.SigningKey{},
+		&model.BalanceAdjustment{},
+		&model.AuditEvent{},
+		&model.AccountClosure{},
+		&model.CardAuthorization{},
+		&model.Hold{},
 	)
+	if err := migrateOpeningBalances(DB); err != nil {
+		panic("failed to migrate opening balances")
+	}
+	if err := migrateAccountStatus(DB); err != nil {
+		panic("failed to migrate account statuses")
+	}
+	if err := migrateFailedTransfers(DB); err != nil {
+		panic("failed to migrate failed transfers")
+	}
+	if err := migrateCardHolds(DB); err != nil {
+		panic("failed to migrate card authorization holds")
+	}
+	if err := migrateCardEncryption(DB); err != nil {
+		panic("failed to encrypt card details")
+	}
+	if err := protectAuditLog(DB); err != nil {
+		panic("failed to protect audit log")
+	}
 	fmt.Println("Database Migrated")
 }
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/encryption"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// minorUnitColumns lists money columns that used to be stored as decimal(20,2)
+var minorUnitColumns = map[string][]string{
+	"bank_accounts": {"balance"},
+	"cards":         {"daily_limit"},
+	"transactions":  {"amount"},
+	"postings":      {"amount"},
+}
+
+// minorUnitCurrency gives the SQL expression for the currency of each row of a
+// table, cards take the currency of their account
+var minorUnitCurrency = map[string]string{
+	"bank_accounts": "currency",
+	"cards":         "(SELECT currency FROM bank_accounts WHERE bank_accounts.id = cards.bank_account_id)",
+	"transactions":  "currency",
+	"postings":      "currency",
+}
+
+// migrateMinorUnits converts legacy decimal money columns to integer minor units
+// before AutoMigrate changes their type, so existing values are not truncated.
+// Values are scaled by the exponent of the currency of their row.
+func migrateMinorUnits(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for table, columns := range minorUnitColumns {
+			if !tx.Migrator().HasTable(table) {
+				continue
+			}
+
+			types, err := tx.Migrator().ColumnTypes(table)
+			if err != nil {
+				return err
+			}
+
+			for _, ct := range types {
+				if !slices.Contains(columns, ct.Name()) || !strings.EqualFold(ct.DatabaseTypeName(), "numeric") {
+					continue
+				}
+				// Widen the column first, decimal(20,2) may not fit the scaled values
+				statements := []string{
+					fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE numeric", table, ct.Name()),
+					fmt.Sprintf("UPDATE %s SET %s = ROUND(%s * %s)", table, ct.Name(), ct.Name(), minorUnitFactor(minorUnitCurrency[table])),
+					fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE bigint USING %s::bigint", table, ct.Name(), ct.Name()),
+				}
+				for _, sql := range statements {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// minorUnitFactor builds a SQL expression for 10 to the exponent of the currency,
+// unknown currencies were stored with two decimals
+func minorUnitFactor(currency string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CASE %s", currency)
+	for _, c := range money.Currencies() {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", c, int64(math.Pow10(c.Exponent())))
+	}
+	b.WriteString(" ELSE 100 END")
+	return b.String()
+}
+
+// protectAuditLog makes the audit log append-only at the database level,
+// rejecting any UPDATE, DELETE or TRUNCATE of audit_events
+func protectAuditLog(db *gorm.DB) error {
+	statements := []string{
+		`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_events is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events`,
+		`CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+		FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()`,
+		`DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events`,
+		`CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+		FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only()`,
+	}
+	for _, sql := range statements {
+		if err := db.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAccountStatus marks accounts and cards deactivated before statuses existed
+// as frozen, or cancelled for cards of closed accounts
+func migrateAccountStatus(db *gorm.DB) error {
+	statements := []string{
+		"UPDATE bank_accounts SET status = 'FROZEN', frozen_at = updated_at, frozen_by_staff = true WHERE is_active = false AND status = 'ACTIVE'",
+		`UPDATE cards SET status = 'CANCELLED', cancelled_at = updated_at, cancel_reason = 'ACCOUNT_CLOSED'
+		WHERE is_active = false AND status = 'ACTIVE' AND bank_account_id IN (SELECT id FROM bank_accounts WHERE status = 'CLOSED')`,
+		"UPDATE cards SET status = 'FROZEN', frozen_at = updated_at, frozen_by_staff = true WHERE is_active = false AND status = 'ACTIVE'",
+	}
+	for _, sql := range statements {
+		if err := db.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateFailedTransfers moves the destination of failed transfers recorded before
+// AttemptedToAccountID existed out of to_account_id
+func migrateFailedTransfers(db *gorm.DB) error {
+	return db.Exec(`UPDATE transactions SET attempted_to_account_id = to_account_id, to_account_id = NULL
+		WHERE status = 'FAILED' AND from_account_id IS NOT NULL AND to_account_id IS NOT NULL`).Error
+}
+
+// migrateCardHolds places a hold for each approved card authorization made before
+// holds existed, expiring a week after it was approved
+func migrateCardHolds(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO holds (created_at, updated_at, bank_account_id, kind, status, amount, currency, description, expires_at, transaction_id)
+		SELECT created_at, NOW(), bank_account_id, 'CARD_AUTHORIZATION', 'ACTIVE', billing_amount, billing_currency, merchant_name, created_at + INTERVAL '7 days', transaction_id
+		FROM card_authorizations WHERE status = 'APPROVED' AND hold_id IS NULL AND deleted_at IS NULL`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE card_authorizations SET hold_id = holds.id FROM holds
+		WHERE holds.transaction_id = card_authorizations.transaction_id AND card_authorizations.status = 'APPROVED' AND card_authorizations.hold_id IS NULL`).Error
+	})
+}
+
+// migrateCardEncryption encrypts the plaintext numbers and CVVs of cards issued before
+// encryption, fills in their masked number and lookup hash and drops the old columns
+func migrateCardEncryption(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("cards", "cvv") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var legacy []struct {
+			ID         uint
+			CardNumber string
+			CVV        string
+		}
+		if err := tx.Table("cards").Select("id, card_number, cvv").Where("encrypted_number IS NULL OR encrypted_number = ''").Scan(&legacy).Error; err != nil {
+			return err
+		}
+
+		for _, card := range legacy {
+			number, err := encryption.Seal(card.CardNumber, "card.number")
+			if err != nil {
+				return err
+			}
+			cvv, err := encryption.Seal(card.CVV, "card.cvv")
+			if err != nil {
+				return err
+			}
+			if err := tx.Table("cards").Where("id = ?", card.ID).Updates(map[string]any{
+				"encrypted_number": number,
+				"encrypted_cvv":    cvv,
+				"number_hash":      encryption.Hash(card.CardNumber),
+				"masked_number":    gorm.Expr("LEFT(card_number, 6) || REPEAT('*', LENGTH(card_number) - 10) || RIGHT(card_number, 4)"),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, column := range []string{"card_number", "cvv"} {
+			if err := tx.Migrator().DropColumn("cards", column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateOpeningBalances backs the balance of every account that had money before
+// the ledger existed with an opening balance entry, so its cached and ledger
+// balances agree. Accounts with any posting already are left alone.
+func migrateOpeningBalances(db *gorm.DB) error {
+	var accounts []model.BankAccount
+	if err := db.Select("id", "balance", "currency").
+		Where("balance <> 0 AND NOT EXISTS (SELECT 1 FROM postings WHERE postings.bank_account_id = bank_accounts.id)").
+		Find(&accounts).Error; err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		entry := ledger.OpeningBalance(account.ID, account.Balance, account.Currency)
+		if err := ledger.Validate(entry); err != nil {
+			return fmt.Errorf("account %d: %w", account.ID, err)
+		}
+		if err := db.Create(entry).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// BalanceAdjustment records who corrected an account balance and why
+type BalanceAdjustment struct {
+	gorm.Model
+	TransactionID uint         `gorm:"not null;uniqueIndex" json:"transaction_id"`
+	BankAccountID uint         `gorm:"not null;index" json:"bank_account_id"`
+	AdminID       uint         `gorm:"not null;index" json:"admin_id"`
+	Amount        money.Amount `gorm:"not null" json:"amount"` // signed, negative amounts debit the account
+	Currency      Currency     `gorm:"not null" json:"currency"`
+	Reason        string       `gorm:"not null" json:"reason"`
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Snapshot is the JSON state of an audited record, stored as text so the
+// hash covers exactly the bytes that were written
+type Snapshot string
+
+// MarshalJSON embeds the snapshot as JSON instead of a quoted string
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return []byte("null"), nil
+	}
+	return json.RawMessage(s), nil
+}
+
+// AuditEvent is an append-only record of a security or financial event.
+// Each event includes the hash of the one before it, so editing or deleting
+// an event breaks the chain from that point on.
+type AuditEvent struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `gorm:"not null;index" json:"created_at"`
+	ActorID    *uint     `gorm:"index" json:"actor_id"` // nil for anonymous requests and the system
+	ActorRole  Role      `json:"actor_role,omitempty"`
+	Action     string    `gorm:"not null;index" json:"action"`
+	TargetType string    `gorm:"index:idx_audit_events_target" json:"target_type,omitempty"`
+	TargetID   string    `gorm:"index:idx_audit_events_target" json:"target_id,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Before     Snapshot  `gorm:"type:text" json:"before"`
+	After      Snapshot  `gorm:"type:text" json:"after"`
+	PrevHash   string    `gorm:"not null" json:"prev_hash"`
+	Hash       string    `gorm:"not null;uniqueIndex" json:"hash"`
+}
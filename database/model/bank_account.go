@@ -1,18 +1,21 @@
 package model
 
 import (
+	"slices"
 	"time"
 
+	"github.com/denver-code/moza-backend/money"
+
 	"gorm.io/gorm"
 )
 
 // Currency type for handling different currencies
-type Currency string
+type Currency = money.Currency
 
 const (
-	USD Currency = "USD"
-	EUR Currency = "EUR"
-	GBP Currency = "GBP"
+	USD = money.USD
+	EUR = money.EUR
+	GBP = money.GBP
 )
 
 // AccountType represents the type of bank account
@@ -24,40 +27,180 @@ const (
 	BUSINESS AccountType = "BUSINESS"
 )
 
+// AccountStatus is the lifecycle state of a bank account
+type AccountStatus string
+
+const (
+	ACCOUNT_ACTIVE AccountStatus = "ACTIVE"
+	ACCOUNT_FROZEN AccountStatus = "FROZEN" // temporarily blocked, no money can move
+	ACCOUNT_CLOSED AccountStatus = "CLOSED" // permanently closed with a zero balance
+)
+
 // BankAccount represents a user's bank account
 type BankAccount struct {
 	gorm.Model
-	UserID      uint        `gorm:"not null" json:"user_id"`
-	AccountType AccountType `gorm:"not null" json:"account_type"`
-	Currency    Currency    `gorm:"not null" json:"currency"`
-	Balance     float64     `gorm:"type:decimal(20,2);not null;default:0.00" json:"balance"`
-	AccountNumber string    `gorm:"uniqueIndex;not null" json:"account_number"`
-	IsActive    bool       `gorm:"not null;default:true" json:"is_active"`
-	LastActivity time.Time  `json:"last_activity"`
+	UserID        uint          `gorm:"not null" json:"user_id"`
+	AccountType   AccountType   `gorm:"not null" json:"account_type"`
+	Currency      Currency      `gorm:"not null" json:"currency"`
+	Balance       money.Amount  `gorm:"not null;default:0" json:"balance"` // ledger balance, including funds on hold
+	AccountNumber string        `gorm:"uniqueIndex;not null" json:"account_number"`
+	Status        AccountStatus `gorm:"not null;default:ACTIVE;index" json:"status"`
+	IsActive      bool          `gorm:"not null;default:true" json:"is_active"` // true only while Status is ACTIVE
+	LastActivity  time.Time     `json:"last_activity"`
+
+	// Set while the account is frozen, a freeze by staff can only be lifted by staff
+	FrozenAt      *time.Time `json:"frozen_at,omitempty"`
+	FreezeReason  string     `json:"freeze_reason,omitempty"`
+	FrozenByStaff bool       `gorm:"not null;default:false" json:"frozen_by_staff"`
+	ClosedAt      *time.Time `json:"closed_at,omitempty"`
+
+	// Balance less active holds, filled in for responses only
+	AvailableBalance money.Amount `gorm:"-" json:"available_balance"`
 }
 
+// AccountClosure records why and by whom an account was closed and where its money went
+type AccountClosure struct {
+	gorm.Model
+	BankAccountID      uint         `gorm:"not null;uniqueIndex" json:"bank_account_id"`
+	UserID             uint         `gorm:"not null;index" json:"user_id"`
+	ClosedByID         uint         `gorm:"not null" json:"closed_by_id"` // the owner or a member of staff
+	Reason             string       `gorm:"not null" json:"reason"`
+	SweepAccountID     *uint        `json:"sweep_account_id,omitempty"`
+	SweepTransactionID *uint        `json:"sweep_transaction_id,omitempty"`
+	SweptAmount        money.Amount `gorm:"not null;default:0" json:"swept_amount"`
+}
+
+// CardStatus is the lifecycle state of a card
+type CardStatus string
+
+const (
+	CARD_ACTIVE    CardStatus = "ACTIVE"
+	CARD_FROZEN    CardStatus = "FROZEN"    // temporarily blocked by the holder or staff
+	CARD_CANCELLED CardStatus = "CANCELLED" // permanently blocked
+)
+
+// CardCancelReason explains why a card was cancelled
+type CardCancelReason string
+
+const (
+	CARD_LOST           CardCancelReason = "LOST"
+	CARD_STOLEN         CardCancelReason = "STOLEN"
+	CARD_DAMAGED        CardCancelReason = "DAMAGED"
+	CARD_EXPIRED        CardCancelReason = "EXPIRED"
+	CARD_ACCOUNT_CLOSED CardCancelReason = "ACCOUNT_CLOSED"
+	CARD_OTHER          CardCancelReason = "OTHER"
+)
+
 // Card represents a payment card associated with a bank account
 type Card struct {
 	gorm.Model
-	UserID        uint      `gorm:"not null" json:"user_id"`
-	BankAccountID uint      `gorm:"not null" json:"bank_account_id"`
-	CardNumber    string    `gorm:"uniqueIndex;not null" json:"card_number"`
-	ExpiryDate    time.Time `gorm:"not null" json:"expiry_date"`
-	CVV          string    `gorm:"not null" json:"-"` // CVV is hidden in JSON responses
-	IsActive     bool      `gorm:"not null;default:true" json:"is_active"`
-	DailyLimit   float64   `gorm:"type:decimal(20,2);not null" json:"daily_limit"`
-	CardType     string    `gorm:"not null" json:"card_type"` // VISA, MASTERCARD, etc.
+	UserID        uint         `gorm:"not null" json:"user_id"`
+	BankAccountID uint         `gorm:"not null" json:"bank_account_id"`
+	ExpiryDate    time.Time    `gorm:"not null" json:"expiry_date"`
+	Status        CardStatus   `gorm:"not null;default:ACTIVE;index" json:"status"`
+	IsActive      bool         `gorm:"not null;default:true" json:"is_active"` // true only while Status is ACTIVE
+	DailyLimit    money.Amount `gorm:"not null" json:"daily_limit"`            // card spending per rolling 24 hours, 0 for no limit
+	CardType      string       `gorm:"not null" json:"card_type"`              // VISA, MASTERCARD, etc.
+
+	// The number and CVV are only stored envelope encrypted. Responses show the masked
+	// number, the plaintext is set only while issuing a card or revealing its details.
+	CardNumber      string `gorm:"-" json:"-"`
+	CVV             string `gorm:"-" json:"-"`
+	MaskedNumber    string `gorm:"not null;default:''" json:"card_number"` // first six and last four digits
+	NumberHash      string `gorm:"uniqueIndex" json:"-"`                   // keyed hash to find a card by its number
+	EncryptedNumber string `json:"-"`
+	EncryptedCVV    string `json:"-"`
+
+	// Set while the card is frozen, a freeze by staff can only be lifted by staff
+	FrozenAt      *time.Time `json:"frozen_at,omitempty"`
+	FrozenByStaff bool       `gorm:"not null;default:false" json:"frozen_by_staff"`
+
+	// A cancellation by staff can only be followed by a replacement from staff
+	CancelledAt      *time.Time       `json:"cancelled_at,omitempty"`
+	CancelledByStaff bool             `gorm:"not null;default:false" json:"cancelled_by_staff"`
+	CancelReason     CardCancelReason `json:"cancel_reason,omitempty"`
+	CancelNote       string           `json:"cancel_note,omitempty"`
+
+	// A replacement links back to the card it replaces, and the old card forward to it
+	ReplacesCardID   *uint `gorm:"index" json:"replaces_card_id,omitempty"`
+	ReplacedByCardID *uint `json:"replaced_by_card_id,omitempty"`
 }
 
-// Transaction represents a financial transaction
+// TransactionType is the kind of money movement a transaction records
+type TransactionType string
+
+const (
+	TRANSFER   TransactionType = "TRANSFER"
+	DEPOSIT    TransactionType = "DEPOSIT"
+	WITHDRAWAL TransactionType = "WITHDRAWAL"
+
+	// Internal movements between an account and one of its pots
+	POT_DEPOSIT    TransactionType = "POT_DEPOSIT"
+	POT_WITHDRAWAL TransactionType = "POT_WITHDRAWAL"
+
+	// Manual balance correction made by an admin
+	ADJUSTMENT TransactionType = "ADJUSTMENT"
+
+	// Card purchase, AUTHORISED while the funds are held and COMPLETED once captured
+	CARD_PAYMENT TransactionType = "CARD_PAYMENT"
+)
+
+// TransactionStatus is a step in the lifecycle of a transaction
+type TransactionStatus string
+
+const (
+	PENDING    TransactionStatus = "PENDING"
+	AUTHORISED TransactionStatus = "AUTHORISED"
+	COMPLETED  TransactionStatus = "COMPLETED"
+	FAILED     TransactionStatus = "FAILED"
+	REVERSED   TransactionStatus = "REVERSED"
+)
+
+// transactionTransitions lists the statuses each status may move to
+var transactionTransitions = map[TransactionStatus][]TransactionStatus{
+	PENDING:    {AUTHORISED, COMPLETED, FAILED},
+	AUTHORISED: {COMPLETED, FAILED, REVERSED},
+	COMPLETED:  {REVERSED},
+}
+
+// CanTransition reports whether a transaction may move from s to the given status
+func (s TransactionStatus) CanTransition(to TransactionStatus) bool {
+	return slices.Contains(transactionTransitions[s], to)
+}
+
+// Transaction represents a financial transaction.
+// Deposits have no FromAccountID and withdrawals have no ToAccountID,
+// their external side is described by the Counterparty fields instead.
+// Failed transfers keep their destination in AttemptedToAccountID, so they never
+// show up in the history of the account they were meant for.
 type Transaction struct {
 	gorm.Model
-	FromAccountID uint    `gorm:"not null" json:"from_account_id"`
-	ToAccountID   uint    `gorm:"not null" json:"to_account_id"`
-	Amount        float64 `gorm:"type:decimal(20,2);not null" json:"amount"`
-	Currency      Currency `gorm:"not null" json:"currency"`
-	Description   string  `json:"description"`
-	Type         string  `gorm:"not null" json:"type"` // TRANSFER, DEPOSIT, WITHDRAWAL
-	Status       string  `gorm:"not null" json:"status"` // PENDING, COMPLETED, FAILED
-	Reference    string  `gorm:"uniqueIndex;not null" json:"reference"`
-} 
\ No newline at end of file
+	FromAccountID        *uint             `gorm:"index" json:"from_account_id"`
+	ToAccountID          *uint             `gorm:"index" json:"to_account_id"`
+	AttemptedToAccountID *uint             `gorm:"index" json:"attempted_to_account_id,omitempty"`
+	Amount               money.Amount      `gorm:"not null" json:"amount"`
+	Currency             Currency          `gorm:"not null" json:"currency"`
+	Description          string            `json:"description"`
+	Type                 TransactionType   `gorm:"not null" json:"type"`
+	Status               TransactionStatus `gorm:"not null;index" json:"status"`
+	FailureReason        string            `json:"failure_reason,omitempty"` // why it failed or was reversed
+	Reference            string            `gorm:"uniqueIndex;not null" json:"reference"`
+
+	// Destination leg of cross-currency transfers, equal to Amount and Currency otherwise
+	ToAmount     money.Amount `gorm:"not null;default:0" json:"to_amount"`
+	ToCurrency   Currency     `json:"to_currency"`
+	ExchangeRate money.Rate   `gorm:"not null;default:0" json:"exchange_rate,omitempty"`
+	SpreadBps    int          `gorm:"not null;default:0" json:"spread_bps,omitempty"`
+	FXQuoteID    *uint        `json:"fx_quote_id,omitempty"`
+
+	// External side of deposits and withdrawals
+	CounterpartyName    string `json:"counterparty_name,omitempty"`
+	CounterpartyAccount string `json:"counterparty_account,omitempty"` // e.g. IBAN or sort code and account number
+	ExternalReference   string `json:"external_reference,omitempty"`
+
+	// Pot involved in internal pot movements
+	PotID *uint `gorm:"index" json:"pot_id,omitempty"`
+
+	// Standing order or future-dated payment that created the transaction
+	ScheduledPaymentID *uint `gorm:"index" json:"scheduled_payment_id,omitempty"`
+}
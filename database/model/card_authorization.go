@@ -0,0 +1,64 @@
+package model
+
+import (
+	"time"
+
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// AuthorizationStatus is the outcome of a card authorization and what happened to it later
+type AuthorizationStatus string
+
+const (
+	AUTH_APPROVED AuthorizationStatus = "APPROVED" // funds are held until captured or released
+	AUTH_DECLINED AuthorizationStatus = "DECLINED"
+	AUTH_CAPTURED AuthorizationStatus = "CAPTURED"
+	AUTH_RELEASED AuthorizationStatus = "RELEASED"
+	AUTH_EXPIRED  AuthorizationStatus = "EXPIRED" // not captured before its hold expired
+)
+
+// DeclineReason tells the merchant why an authorization was declined
+type DeclineReason string
+
+const (
+	DECLINE_CARD_INACTIVE      DeclineReason = "CARD_INACTIVE"
+	DECLINE_ACCOUNT_INACTIVE   DeclineReason = "ACCOUNT_INACTIVE"
+	DECLINE_INVALID_EXPIRY     DeclineReason = "INVALID_EXPIRY"
+	DECLINE_EXPIRED_CARD       DeclineReason = "EXPIRED_CARD"
+	DECLINE_INVALID_CVV        DeclineReason = "INVALID_CVV"
+	DECLINE_CURRENCY           DeclineReason = "CURRENCY_NOT_SUPPORTED"
+	DECLINE_LIMIT_EXCEEDED     DeclineReason = "DAILY_LIMIT_EXCEEDED"
+	DECLINE_INSUFFICIENT_FUNDS DeclineReason = "INSUFFICIENT_FUNDS"
+)
+
+// CardAuthorization is a merchant's request to charge a card. An approved authorization
+// holds the funds on the account until the merchant captures or releases it, or the hold expires.
+type CardAuthorization struct {
+	gorm.Model
+	CardID        uint                `gorm:"not null;index" json:"card_id"`
+	BankAccountID uint                `gorm:"not null;index" json:"bank_account_id"`
+	TransactionID *uint               `gorm:"index" json:"transaction_id,omitempty"` // set once approved
+	HoldID        *uint               `gorm:"index" json:"hold_id,omitempty"`        // set once approved
+	Status        AuthorizationStatus `gorm:"not null;index" json:"status"`
+	DeclineReason DeclineReason       `json:"decline_reason,omitempty"`
+	AuthCode      string              `json:"auth_code,omitempty"`
+
+	// Amount requested by the merchant in its own currency
+	Amount   money.Amount `gorm:"not null" json:"amount"`
+	Currency Currency     `gorm:"not null" json:"currency"`
+
+	// Amount held on the account in the account currency
+	BillingAmount   money.Amount `gorm:"not null;default:0" json:"billing_amount"`
+	BillingCurrency Currency     `gorm:"not null" json:"billing_currency"`
+
+	MerchantName string `gorm:"not null" json:"merchant_name"`
+	MCC          string `gorm:"not null" json:"mcc"` // ISO 18245 merchant category code
+
+	// Set once the merchant settles, a capture may be for less than the authorized amount
+	CapturedAmount        money.Amount `gorm:"not null;default:0" json:"captured_amount"`
+	CapturedBillingAmount money.Amount `gorm:"not null;default:0" json:"captured_billing_amount"`
+	CapturedAt            *time.Time   `json:"captured_at,omitempty"`
+	ReleasedAt            *time.Time   `json:"released_at,omitempty"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// ExchangeRate is the mid-market rate for converting FromCurrency into ToCurrency
+type ExchangeRate struct {
+	gorm.Model
+	FromCurrency Currency   `gorm:"not null;uniqueIndex:idx_exchange_rate_pair" json:"from_currency"`
+	ToCurrency   Currency   `gorm:"not null;uniqueIndex:idx_exchange_rate_pair" json:"to_currency"`
+	Rate         money.Rate `gorm:"not null" json:"rate"`
+	SpreadBps    int        `gorm:"not null;default:0" json:"spread_bps"` // margin applied to customers, in basis points
+}
+
+// FXQuote locks an exchange rate for a user for a short period of time
+type FXQuote struct {
+	gorm.Model
+	UserID       uint         `gorm:"not null;index" json:"user_id"`
+	FromCurrency Currency     `gorm:"not null" json:"from_currency"`
+	ToCurrency   Currency     `gorm:"not null" json:"to_currency"`
+	FromAmount   money.Amount `gorm:"not null" json:"from_amount"`
+	ToAmount     money.Amount `gorm:"not null" json:"to_amount"`
+	MidRate      money.Rate   `gorm:"not null" json:"mid_rate"`
+	Rate         money.Rate   `gorm:"not null" json:"rate"` // mid rate with the spread applied
+	SpreadBps    int          `gorm:"not null" json:"spread_bps"`
+	ExpiresAt    time.Time    `gorm:"not null" json:"expires_at"`
+	UsedAt       *time.Time   `json:"used_at"`
+}
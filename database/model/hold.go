@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// HoldKind is what funds were put on hold for
+type HoldKind string
+
+const (
+	HOLD_CARD_AUTHORIZATION HoldKind = "CARD_AUTHORIZATION" // an approved card payment awaiting capture
+	HOLD_MANUAL             HoldKind = "MANUAL"             // placed by staff, for example during an investigation
+)
+
+// HoldStatus is the lifecycle state of a hold
+type HoldStatus string
+
+const (
+	HOLD_ACTIVE   HoldStatus = "ACTIVE"
+	HOLD_CAPTURED HoldStatus = "CAPTURED" // turned into a completed transaction
+	HOLD_RELEASED HoldStatus = "RELEASED"
+	HOLD_EXPIRED  HoldStatus = "EXPIRED"
+)
+
+// Hold reserves part of an account's balance. Active holds that have not expired are
+// deducted from the ledger balance to give the available balance.
+type Hold struct {
+	gorm.Model
+	BankAccountID uint         `gorm:"not null;index" json:"bank_account_id"`
+	Kind          HoldKind     `gorm:"not null" json:"kind"`
+	Status        HoldStatus   `gorm:"not null;index" json:"status"`
+	Amount        money.Amount `gorm:"not null" json:"amount"` // in minor units of the account currency
+	Currency      Currency     `gorm:"not null" json:"currency"`
+	Description   string       `json:"description"`
+	ExpiresAt     time.Time    `gorm:"not null;index" json:"expires_at"`
+	TransactionID *uint        `gorm:"index" json:"transaction_id,omitempty"` // the AUTHORISED transaction it reserves funds for
+	PlacedByID    *uint        `json:"placed_by_id,omitempty"`                // staff member who placed a manual hold
+	ReleasedAt    *time.Time   `json:"released_at,omitempty"`                 // captured, released or expired
+}
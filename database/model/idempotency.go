@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey stores the outcome of a request made with an Idempotency-Key header
+type IdempotencyKey struct {
+	gorm.Model
+	UserID      uint       `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Key         string     `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	RequestHash string     `gorm:"not null"`
+	StatusCode  int        `gorm:"not null;default:0"`
+	Response    []byte     `gorm:"type:bytea"`
+	CompletedAt *time.Time // nil while the original request is still running
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// PostingDirection is the side of the ledger a posting is written to
+type PostingDirection string
+
+const (
+	DEBIT  PostingDirection = "DEBIT"
+	CREDIT PostingDirection = "CREDIT"
+)
+
+// SystemAccount identifies an internal ledger account that is not a customer bank account
+type SystemAccount string
+
+const (
+	// ExternalClearing is the counterpart for money entering or leaving the bank
+	ExternalClearing SystemAccount = "EXTERNAL_CLEARING"
+	// FXPosition holds the bank's currency position from customer conversions
+	FXPosition SystemAccount = "FX_POSITION"
+	// Adjustments is the counterpart for manual balance corrections by operations staff
+	Adjustments SystemAccount = "ADJUSTMENTS"
+	// CardSettlement is owed to the card network for captured card payments
+	CardSettlement SystemAccount = "CARD_SETTLEMENT"
+	// OpeningBalances is the equity counterpart for balances held before the ledger existed
+	OpeningBalances SystemAccount = "OPENING_BALANCES"
+)
+
+// JournalEntry groups the balanced postings of a single money movement
+type JournalEntry struct {
+	gorm.Model
+	TransactionID *uint     `gorm:"index" json:"transaction_id"`
+	Description   string    `json:"description"`
+	Postings      []Posting `json:"postings"`
+}
+
+// Posting is one debit or credit line of a journal entry.
+// Exactly one of BankAccountID, PotID and SystemAccount is set.
+type Posting struct {
+	gorm.Model
+	JournalEntryID uint             `gorm:"not null;index" json:"journal_entry_id"`
+	BankAccountID  *uint            `gorm:"index" json:"bank_account_id,omitempty"`
+	PotID          *uint            `gorm:"index" json:"pot_id,omitempty"`
+	SystemAccount  SystemAccount    `json:"system_account,omitempty"`
+	Direction      PostingDirection `gorm:"not null" json:"direction"`
+	Amount         money.Amount     `gorm:"not null" json:"amount"`
+	Currency       Currency         `gorm:"not null" json:"currency"`
+}
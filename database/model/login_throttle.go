@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LoginThrottle counts recent failed logins for a user or client IP
+type LoginThrottle struct {
+	gorm.Model
+	Key           string    `gorm:"uniqueIndex;not null"` // user:<id>, identity:<name> or ip:<address>
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"not null"`
+	NextAttemptAt time.Time `gorm:"not null"` // progressive delay between attempts
+	LockedUntil   *time.Time
+}
+
+// LockoutEvent records a temporary lockout triggered by repeated failed logins
+type LockoutEvent struct {
+	gorm.Model
+	Key         string    `gorm:"not null;index" json:"key"`
+	UserID      *uint     `gorm:"index" json:"user_id"`
+	IP          string    `json:"ip"`
+	Failures    int       `gorm:"not null" json:"failures"`
+	LockedUntil time.Time `gorm:"not null" json:"locked_until"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// Pot is a ring-fenced sub-balance inside a bank account.
+// Money in a pot is not part of the account balance.
+type Pot struct {
+	gorm.Model
+	UserID        uint         `gorm:"not null;index" json:"user_id"`
+	BankAccountID uint         `gorm:"not null;index" json:"bank_account_id"`
+	Name          string       `gorm:"not null" json:"name"`
+	Currency      Currency     `gorm:"not null" json:"currency"`
+	Balance       money.Amount `gorm:"not null;default:0" json:"balance"`
+	GoalAmount    money.Amount `gorm:"not null;default:0" json:"goal_amount"`
+	LockedUntil   *time.Time   `json:"locked_until"` // withdrawals are refused until then
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RevokedToken blocks an access token by its jti claim until it would have expired anyway
+type RevokedToken struct {
+	gorm.Model
+	JTI       string    `gorm:"uniqueIndex;not null"`
+	UserID    uint      `gorm:"not null;index"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	Reason    string
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+)
+
+// Frequency is how often a scheduled payment repeats
+type Frequency string
+
+const (
+	ONCE    Frequency = "ONCE"
+	WEEKLY  Frequency = "WEEKLY"
+	MONTHLY Frequency = "MONTHLY"
+	CUSTOM  Frequency = "CUSTOM" // every IntervalDays days
+)
+
+// ScheduleStatus is the state of a scheduled payment
+type ScheduleStatus string
+
+const (
+	SCHEDULE_ACTIVE    ScheduleStatus = "ACTIVE"
+	SCHEDULE_PAUSED    ScheduleStatus = "PAUSED"
+	SCHEDULE_CANCELLED ScheduleStatus = "CANCELLED"
+	SCHEDULE_COMPLETED ScheduleStatus = "COMPLETED"
+	SCHEDULE_FAILED    ScheduleStatus = "FAILED"
+)
+
+// ScheduledPayment is a future-dated or recurring transfer, such as a standing order
+type ScheduledPayment struct {
+	gorm.Model
+	UserID        uint           `gorm:"not null;index" json:"user_id"`
+	FromAccountID uint           `gorm:"not null" json:"from_account_id"`
+	ToAccountID   uint           `gorm:"not null" json:"to_account_id"`
+	Amount        money.Amount   `gorm:"not null" json:"amount"` // in minor units of the source currency
+	Description   string         `json:"description"`
+	Frequency     Frequency      `gorm:"not null" json:"frequency"`
+	IntervalDays  int            `gorm:"not null;default:0" json:"interval_days,omitempty"`
+	StartDate     time.Time      `gorm:"not null" json:"start_date"`
+	EndDate       *time.Time     `json:"end_date"`
+	Status        ScheduleStatus `gorm:"not null;index" json:"status"`
+
+	// Occurrences counts executed or skipped payments, NextPaymentDate is the next one due
+	Occurrences     int       `gorm:"not null;default:0" json:"occurrences"`
+	NextPaymentDate time.Time `gorm:"not null" json:"next_payment_date"`
+	// NextAttemptAt is later than NextPaymentDate while a failed payment is being retried
+	NextAttemptAt     time.Time `gorm:"not null;index" json:"next_attempt_at"`
+	FailedAttempts    int       `gorm:"not null;default:0" json:"failed_attempts"`
+	LastError         string    `json:"last_error,omitempty"`
+	LastTransactionID *uint     `json:"last_transaction_id"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a signed-in device, kept alive by rotating refresh tokens
+type Session struct {
+	gorm.Model
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// RefreshToken is a single-use token of a session, only its hash is stored.
+// Presenting a token that was already used revokes the whole session.
+type RefreshToken struct {
+	gorm.Model
+	SessionID uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SigningKey is a key pair used to sign access tokens, identified in tokens by its kid.
+// New keys are published before they start signing at ActivatesAt. Retired keys
+// no longer sign but stay valid for verification until they expire.
+type SigningKey struct {
+	gorm.Model
+	KID         string     `gorm:"uniqueIndex;not null"`
+	Algorithm   string     `gorm:"not null"` // RS256 or EdDSA
+	PrivateKey  string     `gorm:"not null"` // PKCS #8 PEM, sealed with the encryption package
+	PublicKey   string     `gorm:"not null"` // PKIX PEM
+	ActivatesAt *time.Time `gorm:"index"`    // nil for keys that signed from creation
+	RetiredAt   *time.Time `gorm:"index"`
+	ExpiresAt   *time.Time `gorm:"index"`
+}
+
+// Activation returns when the key starts signing tokens
+func (k *SigningKey) Activation() time.Time {
+	if k.ActivatesAt == nil {
+		return k.CreatedAt
+	}
+	return *k.ActivatesAt
+}
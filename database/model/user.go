@@ -1,6 +1,24 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Role decides which parts of the API a user can reach
+type Role string
+
+const (
+	ROLE_CUSTOMER Role = "CUSTOMER"
+	ROLE_SUPPORT  Role = "SUPPORT" // operations staff, read access and freezes
+	ROLE_ADMIN    Role = "ADMIN"
+)
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	return r == ROLE_CUSTOMER || r == ROLE_SUPPORT || r == ROLE_ADMIN
+}
 
 // User struct
 type User struct {
@@ -9,4 +27,54 @@ type User struct {
 	Email    string `gorm:"uniqueIndex;not null" json:"email"`
 	Password string `gorm:"not null" json:"-"`
 	FullName string `json:"full_name"`
+	Role     Role   `gorm:"not null;default:CUSTOMER" json:"role"`
+
+	EmailVerified   bool       `gorm:"not null;default:false" json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// Access tokens issued before this time are rejected, set on password change or forced logout
+	TokensValidAfter *time.Time `json:"-"`
+
+	// TOTP two-factor authentication, the secret is set during enrollment
+	// and only used once TOTPEnabled is confirmed
+	TOTPSecret      string `json:"-"`
+	TOTPEnabled     bool   `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastCounter int64  `gorm:"not null;default:0" json:"-"` // last accepted time step, blocks code replay
+}
+
+// RecoveryCode is a single-use backup code for two-factor authentication
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"not null;index"`
+	CodeHash string `gorm:"not null"`
+	UsedAt   *time.Time
+}
+
+// LoginChallenge is issued by Login when the user still has to pass two-factor authentication
+type LoginChallenge struct {
+	gorm.Model
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	Attempts  int       `gorm:"not null;default:0"`
+	UsedAt    *time.Time
+}
+
+// TokenPurpose is what a single-use user token may be exchanged for
+type TokenPurpose string
+
+const (
+	PASSWORD_RESET     TokenPurpose = "PASSWORD_RESET"
+	EMAIL_VERIFICATION TokenPurpose = "EMAIL_VERIFICATION"
+)
+
+// UserToken is a single-use token sent to a user by email, only its hash is stored
+type UserToken struct {
+	gorm.Model
+	UserID    uint         `gorm:"not null;index"`
+	Purpose   TokenPurpose `gorm:"not null"`
+	TokenHash string       `gorm:"uniqueIndex;not null"`
+	Email     string       `gorm:"not null"` // address the token was sent to
+	ExpiresAt time.Time    `gorm:"not null"`
+	UsedAt    *time.Time
 }
@@ -0,0 +1,146 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/denver-code/moza-backend/config"
+)
+
+// version prefixes every sealed value so the format can change later
+const version = "v1"
+
+var ErrMalformed = errors.New("malformed encrypted value")
+
+// Keys provides the keys for Seal, Open and Hash, set by Setup
+var Keys KeyProvider
+
+// Setup loads the keys from ENCRYPTION_KEYS_FILE, or from ENCRYPTION_KEYS,
+// ENCRYPTION_CURRENT_KEY and ENCRYPTION_HASH_KEY
+func Setup() error {
+	var keys *StaticKeys
+	var err error
+	if path := config.Config("ENCRYPTION_KEYS_FILE"); path != "" {
+		keys, err = LoadFile(path)
+	} else if list := config.Config("ENCRYPTION_KEYS"); list != "" {
+		keys, err = ParseEnv(list, config.Config("ENCRYPTION_CURRENT_KEY"), config.Config("ENCRYPTION_HASH_KEY"))
+	} else {
+		err = ErrNoKeys
+	}
+	if err != nil {
+		return err
+	}
+
+	Keys = keys
+	log.Printf("Encryption: %d keys, current %s", len(keys.Keys), keys.Current)
+	return nil
+}
+
+// Seal encrypts plaintext with a fresh data key, which is itself encrypted with the
+// current key encryption key. Context names what the value is, e.g. "card.number",
+// and must be given again to open it so values cannot be swapped between fields.
+// The result has the form v1.<key id>.<wrapped data key>.<ciphertext>.
+func Seal(plaintext, context string) (string, error) {
+	keyID := Keys.CurrentKeyID()
+	kek, err := Keys.Key(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(kek, dataKey, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext), []byte(context))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		version,
+		keyID,
+		base64.RawURLEncoding.EncodeToString(wrapped),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+	}, "."), nil
+}
+
+// Open decrypts a value made by Seal with the same context
+func Open(sealed, context string) (string, error) {
+	parts := strings.Split(sealed, ".")
+	if len(parts) != 4 || parts[0] != version {
+		return "", ErrMalformed
+	}
+	keyID := parts[1]
+	wrapped, err1 := base64.RawURLEncoding.DecodeString(parts[2])
+	ciphertext, err2 := base64.RawURLEncoding.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return "", ErrMalformed
+	}
+
+	kek, err := Keys.Key(keyID)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := open(kek, wrapped, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, ciphertext, []byte(context))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Hash returns a keyed hash of value to store as a blind index, so rows can be
+// found by a secret value without storing it in plaintext
+func Hash(value string) string {
+	mac := hmac.New(sha256.New, Keys.HashKey())
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal encrypts with AES-GCM and prepends the random nonce
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, sealed, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,118 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// useKeys installs static keys with the given IDs for the duration of one test
+func useKeys(t *testing.T, current string, ids ...string) *StaticKeys {
+	t.Helper()
+	keys := &StaticKeys{Current: current, Keys: map[string][]byte{}, Hash: make([]byte, KeySize)}
+	for i, id := range ids {
+		keys.Keys[id] = []byte(strings.Repeat(string(rune('a'+i)), KeySize))
+	}
+	if err := keys.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := Keys
+	Keys = keys
+	t.Cleanup(func() { Keys = previous })
+	return keys
+}
+
+func TestSealOpen(t *testing.T) {
+	useKeys(t, "k1", "k1")
+
+	sealed, err := Seal("4111111111111111", "card.number")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "4111111111111111") || !strings.HasPrefix(sealed, "v1.k1.") {
+		t.Fatalf("unexpected sealed value %q", sealed)
+	}
+
+	opened, err := Open(sealed, "card.number")
+	if err != nil || opened != "4111111111111111" {
+		t.Errorf("Open = %q, %v", opened, err)
+	}
+
+	again, _ := Seal("4111111111111111", "card.number")
+	if again == sealed {
+		t.Error("sealing the same value twice gave the same result")
+	}
+}
+
+func TestOpenWrongContext(t *testing.T) {
+	useKeys(t, "k1", "k1")
+
+	sealed, err := Seal("123", "card.cvv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(sealed, "card.number"); err == nil {
+		t.Error("a value opened under another context")
+	}
+}
+
+func TestOpenWrongKey(t *testing.T) {
+	keys := useKeys(t, "k1", "k1")
+	sealed, err := Seal("secret", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same key ID, different key material
+	keys.Keys["k1"] = []byte(strings.Repeat("z", KeySize))
+	if _, err := Open(sealed, "test"); err == nil {
+		t.Error("a value opened with a different key")
+	}
+
+	delete(keys.Keys, "k1")
+	if _, err := Open(sealed, "test"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("opening with a missing key returned %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestOpenAfterRotation(t *testing.T) {
+	keys := useKeys(t, "k1", "k1", "k2")
+	sealed, err := Seal("secret", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Values sealed with a retired key stay readable
+	keys.Current = "k2"
+	if opened, err := Open(sealed, "test"); err != nil || opened != "secret" {
+		t.Errorf("Open after rotation = %q, %v", opened, err)
+	}
+	resealed, _ := Seal("secret", "test")
+	if !strings.HasPrefix(resealed, "v1.k2.") {
+		t.Errorf("new values are not sealed with the current key: %q", resealed)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	useKeys(t, "k1", "k1")
+	sealed, err := Seal("secret", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(sealed, ".")
+	ciphertext, _ := base64.RawURLEncoding.DecodeString(parts[3])
+	ciphertext[0] ^= 1
+	parts[3] = base64.RawURLEncoding.EncodeToString(ciphertext)
+	if _, err := Open(strings.Join(parts, "."), "test"); err == nil {
+		t.Error("a tampered value opened")
+	}
+
+	for _, malformed := range []string{"", "v1.k1.abc", "v2.k1.a.b", "v1.k1.!!.b"} {
+		if _, err := Open(malformed, "test"); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Open(%q) returned %v, want ErrMalformed", malformed, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the length of key encryption keys and data keys, for AES-256
+const KeySize = 32
+
+var (
+	ErrUnknownKey = errors.New("unknown key encryption key")
+	ErrNoKeys     = errors.New("no encryption keys configured, set ENCRYPTION_KEYS_FILE or ENCRYPTION_KEYS")
+)
+
+// KeyProvider holds the key encryption keys that wrap the data key of each value.
+// Retired keys stay available so values wrapped with them can still be read.
+type KeyProvider interface {
+	// CurrentKeyID returns the key new data keys are wrapped with
+	CurrentKeyID() string
+	// Key returns the key encryption key with the given ID
+	Key(id string) ([]byte, error)
+	// HashKey returns the key of the blind index used to look values up by equality
+	HashKey() []byte
+}
+
+// StaticKeys is a KeyProvider backed by keys read from a file or the environment,
+// meant for local use. Production deployments should plug in a KMS.
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+	Hash    []byte
+}
+
+func (k *StaticKeys) CurrentKeyID() string { return k.Current }
+
+func (k *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+func (k *StaticKeys) HashKey() []byte { return k.Hash }
+
+// validate checks the current key exists and every key has the right size
+func (k *StaticKeys) validate() error {
+	if len(k.Keys) == 0 {
+		return ErrNoKeys
+	}
+	if _, ok := k.Keys[k.Current]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, k.Current)
+	}
+	for id, key := range k.Keys {
+		if id == "" || strings.Contains(id, ".") {
+			return fmt.Errorf("key ID %q must be non-empty and contain no dots", id)
+		}
+		if len(key) != KeySize {
+			return fmt.Errorf("key %q must be %d bytes", id, KeySize)
+		}
+	}
+	if len(k.Hash) < KeySize {
+		return fmt.Errorf("hash key must be at least %d bytes", KeySize)
+	}
+	return nil
+}
+
+// LoadFile reads keys from a JSON file of the form
+// {"current": "k2", "keys": {"k1": "<base64>", "k2": "<base64>"}, "hash_key": "<base64>"}
+func LoadFile(path string) (*StaticKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Current string            `json:"current"`
+		Keys    map[string]string `json:"keys"`
+		HashKey string            `json:"hash_key"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	keys := &StaticKeys{Current: file.Current, Keys: map[string][]byte{}}
+	for id, encoded := range file.Keys {
+		if keys.Keys[id], err = decodeKey(encoded); err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+	}
+	if keys.Hash, err = decodeKey(file.HashKey); err != nil {
+		return nil, fmt.Errorf("hash key: %w", err)
+	}
+	return keys, keys.validate()
+}
+
+// ParseEnv reads keys given as a comma separated list of id:base64 pairs.
+// The first key is current unless current names another one.
+func ParseEnv(list, current, hashKey string) (*StaticKeys, error) {
+	keys := &StaticKeys{Current: current, Keys: map[string][]byte{}}
+	for _, pair := range strings.Split(list, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			continue
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		keys.Keys[id] = key
+		if keys.Current == "" {
+			keys.Current = id
+		}
+	}
+
+	var err error
+	if keys.Hash, err = decodeKey(hashKey); err != nil {
+		return nil, fmt.Errorf("hash key: %w", err)
+	}
+	return keys, keys.validate()
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+}
@@ -0,0 +1,206 @@
+package fx
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultQuoteTTL is used when FX_QUOTE_TTL is not configured
+const DefaultQuoteTTL = 30 * time.Second
+
+var (
+	ErrRateNotFound = errors.New("no exchange rate for currency pair")
+	ErrInvalidPair  = errors.New("invalid currency pair")
+	ErrInvalidQuote = errors.New("quote not found, expired or already used")
+)
+
+// RateInput is a single rate as found in a rates file or admin request
+type RateInput struct {
+	From      model.Currency `json:"from_currency"`
+	To        model.Currency `json:"to_currency"`
+	Rate      money.Rate     `json:"rate"`
+	SpreadBps int            `json:"spread_bps"`
+}
+
+// Conversion is the result of pricing an amount in another currency
+type Conversion struct {
+	MidRate   money.Rate
+	Rate      money.Rate
+	SpreadBps int
+	ToAmount  money.Amount
+}
+
+// QuoteTTL returns how long a quote locks its rate for
+func QuoteTTL() time.Duration {
+	seconds, err := strconv.Atoi(config.Config("FX_QUOTE_TTL"))
+	if err != nil || seconds <= 0 {
+		return DefaultQuoteTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// SetRate creates or replaces the rate for a currency pair
+func SetRate(db *gorm.DB, input RateInput) (*model.ExchangeRate, error) {
+	if !input.From.Valid() || !input.To.Valid() || input.From == input.To {
+		return nil, ErrInvalidPair
+	}
+	if input.Rate <= 0 || input.SpreadBps < 0 || input.SpreadBps >= 10000 {
+		return nil, money.ErrInvalidRate
+	}
+
+	rate := &model.ExchangeRate{
+		FromCurrency: input.From,
+		ToCurrency:   input.To,
+		Rate:         input.Rate,
+		SpreadBps:    input.SpreadBps,
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "from_currency"}, {Name: "to_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "spread_bps", "updated_at", "deleted_at"}),
+	}).Create(rate).Error
+	return rate, err
+}
+
+// LoadFile seeds the rates from a JSON array in path. It does nothing once any rate is
+// stored, so rates set through the admin API are not overwritten on restart.
+func LoadFile(db *gorm.DB, path string) (int, error) {
+	var stored int64
+	if err := db.Unscoped().Model(&model.ExchangeRate{}).Count(&stored).Error; err != nil {
+		return 0, err
+	}
+	if stored > 0 {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var inputs []RateInput
+	if err := json.Unmarshal(data, &inputs); err != nil {
+		return 0, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, input := range inputs {
+			if _, err := SetRate(tx, input); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(inputs), nil
+}
+
+// LookupRate finds the mid rate and spread for a pair, falling back to the inverse pair
+func LookupRate(db *gorm.DB, from, to model.Currency) (money.Rate, int, error) {
+	var rate model.ExchangeRate
+	err := db.Where(&model.ExchangeRate{FromCurrency: from, ToCurrency: to}).First(&rate).Error
+	if err == nil {
+		return rate.Rate, rate.SpreadBps, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, 0, err
+	}
+
+	err = db.Where(&model.ExchangeRate{FromCurrency: to, ToCurrency: from}).First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, 0, ErrRateNotFound
+	} else if err != nil {
+		return 0, 0, err
+	}
+	return rate.Rate.Inverse(), rate.SpreadBps, nil
+}
+
+// Convert prices amount in the target currency at the current rate
+func Convert(db *gorm.DB, amount money.Amount, from, to model.Currency) (*Conversion, error) {
+	if !from.Valid() || !to.Valid() || from == to {
+		return nil, ErrInvalidPair
+	}
+
+	mid, spread, err := LookupRate(db, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := mid.WithSpread(spread)
+	toAmount, err := rate.Convert(amount, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &Conversion{
+		MidRate:   mid,
+		Rate:      rate,
+		SpreadBps: spread,
+		ToAmount:  toAmount,
+	}, nil
+}
+
+// CreateQuote locks the current rate for a user for QuoteTTL
+func CreateQuote(db *gorm.DB, userID uint, amount money.Amount, from, to model.Currency) (*model.FXQuote, error) {
+	conversion, err := Convert(db, amount, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &model.FXQuote{
+		UserID:       userID,
+		FromCurrency: from,
+		ToCurrency:   to,
+		FromAmount:   amount,
+		ToAmount:     conversion.ToAmount,
+		MidRate:      conversion.MidRate,
+		Rate:         conversion.Rate,
+		SpreadBps:    conversion.SpreadBps,
+		ExpiresAt:    time.Now().Add(QuoteTTL()),
+	}
+	if err := db.Create(quote).Error; err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// UseQuote marks a quote as used for a conversion matching its terms.
+// It must be called inside the database transaction that performs the conversion.
+func UseQuote(tx *gorm.DB, quoteID, userID uint, amount money.Amount, from, to model.Currency) (*model.FXQuote, error) {
+	var quote model.FXQuote
+	if err := tx.Where("id = ? AND user_id = ?", quoteID, userID).First(&quote).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidQuote
+		}
+		return nil, err
+	}
+
+	if quote.UsedAt != nil || time.Now().After(quote.ExpiresAt) ||
+		quote.FromAmount != amount || quote.FromCurrency != from || quote.ToCurrency != to {
+		return nil, ErrInvalidQuote
+	}
+
+	now := time.Now()
+	result := tx.Model(&model.FXQuote{}).
+		Where("id = ? AND used_at IS NULL", quote.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidQuote
+	}
+
+	quote.UsedAt = &now
+	return &quote, nil
+}
@@ -0,0 +1,270 @@
+package admin
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/handler/banking"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/payment"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// GetAccount returns any bank account with its pots and active holds
+func GetAccount(c *fiber.Ctx) error {
+	var account model.BankAccount
+	if err := database.DB.First(&account, c.Params("id")).Error; err != nil {
+		return notFound(c, err, "Account not found")
+	}
+
+	var activeHolds []model.Hold
+	if err := database.DB.Where("bank_account_id = ? AND status = ?", account.ID, model.HOLD_ACTIVE).
+		Order("expires_at").
+		Find(&activeHolds).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve holds",
+			"data":    nil,
+		})
+	}
+	available, err := holds.Available(database.DB, &account)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve available balance",
+			"data":    nil,
+		})
+	}
+	account.AvailableBalance = available
+
+	var pots []model.Pot
+	if err := database.DB.Where("bank_account_id = ?", account.ID).Find(&pots).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve pots",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Account retrieved successfully",
+		"data": fiber.Map{
+			"account": account,
+			"pots":    pots,
+			"holds":   activeHolds,
+		},
+	})
+}
+
+// GetAccountTransactions lists the transactions of any bank account with the
+// same pagination and filters as the customer endpoint
+func GetAccountTransactions(c *fiber.Ctx) error {
+	var account model.BankAccount
+	if err := database.DB.First(&account, c.Params("id")).Error; err != nil {
+		return notFound(c, err, "Account not found")
+	}
+
+	return banking.ListAccountTransactions(c, &account)
+}
+
+// FreezeAccount blocks a bank account, only staff can lift the freeze
+func FreezeAccount(c *fiber.Ctx) error {
+	type FreezeInput struct {
+		Reason string `json:"reason"`
+	}
+
+	input := new(FreezeInput)
+	if err := c.BodyParser(input); err != nil || strings.TrimSpace(input.Reason) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "A reason is required",
+			"data":    nil,
+		})
+	}
+
+	return changeAccountStatus(c, payment.Freeze, input.Reason, audit.ActionAccountFrozen, "Account frozen successfully")
+}
+
+// UnfreezeAccount lifts a freeze on a bank account, whoever placed it
+func UnfreezeAccount(c *fiber.Ctx) error {
+	return changeAccountStatus(c, payment.Unfreeze, "", audit.ActionAccountUnfrozen, "Account unfrozen successfully")
+}
+
+func changeAccountStatus(c *fiber.Ctx, change func(*gorm.DB, payment.AccountRequest) (*model.BankAccount, error), reason, action, success string) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid account ID",
+			"data":    nil,
+		})
+	}
+
+	var before model.BankAccount
+	if err := database.DB.First(&before, id).Error; err != nil {
+		return notFound(c, err, "Account not found")
+	}
+
+	account, err := change(database.DB, payment.AccountRequest{
+		ActorID:   adminID(c),
+		AccountID: uint(id),
+		Staff:     true,
+		Reason:    reason,
+	})
+	if err != nil {
+		return accountError(c, err, "Could not update account")
+	}
+
+	audit.Log(c, audit.Event{Action: action, TargetType: "bank_account", TargetID: account.ID, Before: before, After: account})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": success,
+		"data":    account,
+	})
+}
+
+// CloseAccount closes a customer's account on their behalf, a remaining balance
+// is swept to sweep_account_id which must belong to the same customer
+func CloseAccount(c *fiber.Ctx) error {
+	type CloseInput struct {
+		Reason         string `json:"reason"`
+		SweepAccountID *uint  `json:"sweep_account_id"`
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid account ID",
+			"data":    nil,
+		})
+	}
+
+	input := new(CloseInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	closure, err := payment.Close(database.DB, payment.AccountRequest{
+		ActorID:        adminID(c),
+		AccountID:      uint(id),
+		Staff:          true,
+		Reason:         input.Reason,
+		SweepAccountID: input.SweepAccountID,
+	})
+	if err != nil {
+		return accountError(c, err, "Could not close account")
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionAccountClosed, TargetType: "bank_account", TargetID: closure.BankAccountID, After: closure})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Account closed successfully",
+		"data":    closure,
+	})
+}
+
+// accountError maps account status errors to API responses
+func accountError(c *fiber.Ctx, err error, fallback string) error {
+	status, message := fiber.StatusInternalServerError, fallback
+
+	switch {
+	case errors.Is(err, payment.ErrAccountNotFound):
+		status, message = fiber.StatusNotFound, "Account not found"
+	case errors.Is(err, payment.ErrAccountFrozen):
+		status, message = fiber.StatusConflict, "Account is frozen"
+	case errors.Is(err, payment.ErrAccountClosed):
+		status, message = fiber.StatusConflict, "Account is closed"
+	case errors.Is(err, payment.ErrAccountNotFrozen):
+		status, message = fiber.StatusConflict, "Account is not frozen"
+	case errors.Is(err, payment.ErrPotsNotEmpty):
+		status, message = fiber.StatusConflict, "The account's pots must be emptied first"
+	case errors.Is(err, payment.ErrFundsOnHold):
+		status, message = fiber.StatusConflict, "The account has funds on hold"
+	case errors.Is(err, payment.ErrSweepRequired):
+		status, message = fiber.StatusBadRequest, "A sweep account is required to close an account with a balance"
+	case errors.Is(err, payment.ErrInvalidSweepAccount):
+		status, message = fiber.StatusBadRequest, "Sweep account must be another active account of the same owner"
+	case errors.Is(err, payment.ErrReasonRequired):
+		status, message = fiber.StatusBadRequest, "A reason is required"
+	case errors.Is(err, payment.ErrInvalidAmount):
+		status, message = fiber.StatusBadRequest, "Amount must not be zero"
+	case errors.Is(err, payment.ErrInsufficientFunds):
+		status, message = fiber.StatusBadRequest, "Insufficient balance"
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+		"data":    nil,
+	})
+}
+
+// AdjustBalance credits or debits an account outside the normal payment flows,
+// for example to correct an error. A reason is mandatory and recorded with the admin.
+func AdjustBalance(c *fiber.Ctx) error {
+	type AdjustInput struct {
+		Amount money.Amount `json:"amount"` // signed, in minor units of the account currency
+		Reason string       `json:"reason"`
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid account ID",
+			"data":    nil,
+		})
+	}
+
+	input := new(AdjustInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	transaction, err := payment.Adjust(database.DB, payment.AdjustmentRequest{
+		AdminID:   adminID(c),
+		AccountID: uint(id),
+		Amount:    input.Amount,
+		Reason:    input.Reason,
+	})
+	if err != nil {
+		return accountError(c, err, "Could not adjust balance")
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionBalanceAdjusted, TargetType: "bank_account", TargetID: id, After: fiber.Map{
+		"transaction": transaction,
+		"amount":      input.Amount,
+		"reason":      input.Reason,
+	}})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Balance adjusted successfully",
+		"data":    transaction,
+	})
+}
+
+// adminID returns the ID of the staff member making the request
+func adminID(c *fiber.Ctx) uint {
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	return uint(claims["user_id"].(float64))
+}
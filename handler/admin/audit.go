@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/util"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAuditEvents lists audit events newest first. Supported filters: actor_id,
+// action, target_type, target_id, ip, from and to (RFC 3339 dates).
+// Pass next_cursor back as cursor to get the following page.
+func GetAuditEvents(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", util.DefaultPageSize)
+	if limit < 1 || limit > util.MaxPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Limit must be between 1 and %d", util.MaxPageSize),
+			"data":    nil,
+		})
+	}
+
+	query := database.DB.Model(&model.AuditEvent{})
+	if v := c.Query("actor_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return badFilter(c, "actor_id must be a user ID")
+		}
+		query = query.Where("actor_id = ?", id)
+	}
+	for _, column := range []string{"action", "target_type", "target_id", "ip"} {
+		if v := c.Query(column); v != "" {
+			query = query.Where(column+" = ?", v)
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return badFilter(c, "from must be an RFC 3339 date")
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return badFilter(c, "to must be an RFC 3339 date")
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	// Events are appended in ID order, so the ID alone is a stable cursor
+	if v := c.Query("cursor"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return badFilter(c, "Invalid cursor")
+		}
+		query = query.Where("id < ?", id)
+	}
+
+	var events []model.AuditEvent
+	if err := query.Order("id desc").Limit(limit + 1).Find(&events).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve audit events",
+			"data":    nil,
+		})
+	}
+
+	var nextCursor *string
+	if len(events) > limit {
+		events = events[:limit]
+		cursor := strconv.FormatUint(uint64(events[limit-1].ID), 10)
+		nextCursor = &cursor
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Audit events retrieved successfully",
+		"data": fiber.Map{
+			"events":      events,
+			"next_cursor": nextCursor,
+		},
+	})
+}
+
+// VerifyAuditLog recomputes the hash chain and reports the first tampered event
+func VerifyAuditLog(c *fiber.Ctx) error {
+	brokenAt, checked, err := audit.Verify(database.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not verify audit log",
+			"data":    nil,
+		})
+	}
+
+	if brokenAt != 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Audit log chain is broken",
+			"data": fiber.Map{
+				"broken_at_event_id": brokenAt,
+				"events_checked":     checked,
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Audit log chain is intact",
+		"data": fiber.Map{
+			"events_checked": checked,
+		},
+	})
+}
+
+func badFilter(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+		"data":    nil,
+	})
+}
@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"errors"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/cards"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// FreezeCard blocks a card, the holder cannot lift a freeze placed by staff
+func FreezeCard(c *fiber.Ctx) error {
+	return changeCard(c, cards.Freeze, audit.ActionCardFrozen, "Card frozen successfully")
+}
+
+// UnfreezeCard lifts a freeze on a card
+func UnfreezeCard(c *fiber.Ctx) error {
+	return changeCard(c, cards.Unfreeze, audit.ActionCardUnfrozen, "Card unfrozen successfully")
+}
+
+// CancelCard permanently blocks a card with a reason, for example after fraud
+func CancelCard(c *fiber.Ctx) error {
+	return changeCard(c, cards.Cancel, audit.ActionCardCancelled, "Card cancelled successfully")
+}
+
+func changeCard(c *fiber.Ctx, change func(*gorm.DB, cards.Request) (*model.Card, error), action, success string) error {
+	type CardActionInput struct {
+		Reason model.CardCancelReason `json:"reason"` // cancellation only
+		Note   string                 `json:"note"`
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid card ID",
+			"data":    nil,
+		})
+	}
+
+	input := new(CardActionInput)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid input",
+				"data":    nil,
+			})
+		}
+	}
+
+	var before model.Card
+	if err := database.DB.First(&before, id).Error; err != nil {
+		return notFound(c, err, "Card not found")
+	}
+
+	card, err := change(database.DB, cards.Request{
+		ActorID: adminID(c),
+		CardID:  before.ID,
+		Staff:   true,
+		Reason:  input.Reason,
+		Note:    input.Note,
+	})
+	if err != nil {
+		return cardError(c, err)
+	}
+
+	audit.Log(c, audit.Event{Action: action, TargetType: "card", TargetID: card.ID, Before: audit.CardSnapshot(&before), After: audit.CardSnapshot(card)})
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": success,
+		"data":    card,
+	})
+}
+
+func cardError(c *fiber.Ctx, err error) error {
+	status, message := fiber.StatusInternalServerError, "Could not update card"
+
+	switch {
+	case errors.Is(err, cards.ErrCardNotFound):
+		status, message = fiber.StatusNotFound, "Card not found"
+	case errors.Is(err, cards.ErrInvalidReason):
+		status, message = fiber.StatusBadRequest, "Reason must be LOST, STOLEN, DAMAGED, EXPIRED or OTHER"
+	case errors.Is(err, cards.ErrCardFrozen):
+		status, message = fiber.StatusConflict, "Card is already frozen by staff"
+	case errors.Is(err, cards.ErrCardCancelled):
+		status, message = fiber.StatusConflict, "Card is cancelled"
+	case errors.Is(err, cards.ErrCardNotFrozen):
+		status, message = fiber.StatusConflict, "Card is not frozen"
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+		"data":    nil,
+	})
+}
@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/fx"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetExchangeRates creates or replaces the rates for one or more currency pairs
+func SetExchangeRates(c *fiber.Ctx) error {
+	var inputs []fx.RateInput
+	if err := c.BodyParser(&inputs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	rates := make([]*model.ExchangeRate, 0, len(inputs))
+	tx := database.DB.Begin()
+	for _, input := range inputs {
+		rate, err := fx.SetRate(tx, input)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Could not set exchange rate",
+				"data":    err.Error(),
+			})
+		}
+		rates = append(rates, rate)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not save exchange rates",
+			"data":    nil,
+		})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionRatesUpdated, TargetType: "exchange_rate", After: rates})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Exchange rates updated successfully",
+		"data":    rates,
+	})
+}
@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"errors"
+	"time"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PlaceHold reserves funds on an account, for example while a payment is investigated.
+// The hold lowers the available balance until it is released or expires.
+func PlaceHold(c *fiber.Ctx) error {
+	type HoldInput struct {
+		Amount      money.Amount `json:"amount"` // in minor units of the account currency
+		Description string       `json:"description"`
+		ExpiresAt   time.Time    `json:"expires_at"`
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid account ID",
+			"data":    nil,
+		})
+	}
+
+	input := new(HoldInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	hold, err := holds.PlaceManual(database.DB, holds.ManualRequest{
+		StaffID:     adminID(c),
+		AccountID:   uint(id),
+		Amount:      input.Amount,
+		Description: input.Description,
+		ExpiresAt:   input.ExpiresAt,
+	})
+	if err != nil {
+		return holdError(c, err, "Could not place hold")
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionHoldPlaced, TargetType: "hold", TargetID: hold.ID, After: hold})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Hold placed successfully",
+		"data":    hold,
+	})
+}
+
+// ReleaseHold frees a hold placed by staff
+func ReleaseHold(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid hold ID",
+			"data":    nil,
+		})
+	}
+
+	hold, err := holds.ReleaseManual(database.DB, uint(id))
+	if err != nil {
+		return holdError(c, err, "Could not release hold")
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionHoldReleased, TargetType: "hold", TargetID: hold.ID, After: hold})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Hold released successfully",
+		"data":    hold,
+	})
+}
+
+func holdError(c *fiber.Ctx, err error, fallback string) error {
+	status, message := fiber.StatusInternalServerError, fallback
+
+	switch {
+	case errors.Is(err, holds.ErrAccountNotFound):
+		status, message = fiber.StatusNotFound, "Account not found"
+	case errors.Is(err, holds.ErrHoldNotFound):
+		status, message = fiber.StatusNotFound, "Hold not found"
+	case errors.Is(err, holds.ErrAccountClosed):
+		status, message = fiber.StatusConflict, "Account is closed"
+	case errors.Is(err, holds.ErrDescriptionRequired):
+		status, message = fiber.StatusBadRequest, "A description is required"
+	case errors.Is(err, holds.ErrInvalidAmount):
+		status, message = fiber.StatusBadRequest, "Amount must be positive"
+	case errors.Is(err, holds.ErrInvalidExpiry):
+		status, message = fiber.StatusBadRequest, "Expiry must be in the future"
+	case errors.Is(err, holds.ErrInsufficientFunds):
+		status, message = fiber.StatusBadRequest, "Insufficient available balance"
+	case errors.Is(err, holds.ErrHoldNotActive):
+		status, message = fiber.StatusConflict, "Hold was already captured, released or expired"
+	case errors.Is(err, holds.ErrNotManual):
+		status, message = fiber.StatusConflict, "Only holds placed by staff can be released"
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+		"data":    nil,
+	})
+}
@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RotateSigningKey replaces the access token signing key immediately, for example
+// when a key may have leaked. Tokens signed with the old key stay valid until they
+// expire, unless ?revoke=true drops every old key from verification at once.
+func RotateSigningKey(c *fiber.Ctx) error {
+	revoke := c.QueryBool("revoke")
+	if err := auth.RotateKey(database.DB, revoke); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not rotate signing key",
+			"data":    err.Error(),
+		})
+	}
+
+	action, message := audit.ActionKeyRotated, "Signing key rotated successfully"
+	if revoke {
+		action, message = audit.ActionKeysRevoked, "Signing key rotated and previous keys revoked"
+	}
+	audit.Log(c, audit.Event{Action: action, TargetType: "signing_key"})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": message,
+		"data":    auth.JWKS(),
+	})
+}
@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"errors"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/cards"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/denver-code/moza-backend/payment"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ReverseTransaction undoes a completed or authorised transaction. Authorised card
+// payments are reversed by releasing their authorization and its hold.
+func ReverseTransaction(c *fiber.Ctx) error {
+	type ReverseInput struct {
+		Reason string `json:"reason"`
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid transaction ID",
+			"data":    nil,
+		})
+	}
+
+	input := new(ReverseInput)
+	if err := c.BodyParser(input); err != nil || input.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "A reason is required",
+			"data":    nil,
+		})
+	}
+
+	transaction, err := payment.Reverse(database.DB, uint(id), input.Reason)
+	if errors.Is(err, payment.ErrNotPosted) {
+		return releaseAuthorization(c, uint(id), input.Reason)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Transaction not found",
+				"data":    nil,
+			})
+		case errors.Is(err, payment.ErrIllegalTransition):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Transaction cannot be reversed in its current status",
+				"data":    nil,
+			})
+		case errors.Is(err, payment.ErrAccountClosed):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Transaction touches a closed account",
+				"data":    nil,
+			})
+		case errors.Is(err, payment.ErrInsufficientFunds):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Insufficient balance to reverse transaction",
+				"data":    nil,
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not reverse transaction",
+			"data":    nil,
+		})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionTransactionReversed, TargetType: "transaction", TargetID: transaction.ID, After: transaction})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Transaction reversed successfully",
+		"data":    transaction,
+	})
+}
+
+// releaseAuthorization reverses an authorised card payment by releasing its authorization
+func releaseAuthorization(c *fiber.Ctx, transactionID uint, reason string) error {
+	var found model.CardAuthorization
+	if err := database.DB.Where("transaction_id = ?", transactionID).First(&found).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Transaction was authorised but never posted, there is nothing to reverse",
+				"data":    nil,
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not reverse transaction",
+			"data":    nil,
+		})
+	}
+
+	auth, err := cards.Release(database.DB, found.ID, reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, cards.ErrAuthorizationNotOpen), errors.Is(err, cards.ErrAuthorizationExpired), errors.Is(err, holds.ErrHoldNotActive):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Card authorization was already captured, released or expired",
+				"data":    nil,
+			})
+		case errors.Is(err, cards.ErrAccountInactive):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Transaction touches a closed account",
+				"data":    nil,
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not reverse transaction",
+			"data":    nil,
+		})
+	}
+
+	var transaction model.Transaction
+	if err := database.DB.First(&transaction, transactionID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Card authorization released but the transaction could not be loaded",
+			"data":    nil,
+		})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionCardReleased, TargetType: "card_authorization", TargetID: auth.ID, After: auth})
+	audit.Log(c, audit.Event{Action: audit.ActionTransactionReversed, TargetType: "transaction", TargetID: transaction.ID, After: transaction})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Card authorization released and transaction reversed successfully",
+		"data":    transaction,
+	})
+}
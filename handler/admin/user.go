@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/denver-code/moza-backend/util"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// SearchUsers finds users by username, email or full name (q), newest first.
+// Pass next_cursor back as cursor to get the following page.
+func SearchUsers(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", util.DefaultPageSize)
+	if limit < 1 || limit > util.MaxPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Limit must be between 1 and %d", util.MaxPageSize),
+			"data":    nil,
+		})
+	}
+
+	query := database.DB.Model(&model.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + util.EscapeLike(q) + "%"
+		query = query.Where("username ILIKE ? OR email ILIKE ? OR full_name ILIKE ?", pattern, pattern, pattern)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", strings.ToUpper(role))
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		createdAt, id, err := util.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid cursor",
+				"data":    nil,
+			})
+		}
+		query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+	}
+
+	var users []model.User
+	if err := query.Order("created_at desc, id desc").Limit(limit + 1).Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not search users",
+			"data":    nil,
+		})
+	}
+
+	var nextCursor *string
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		cursor := util.EncodeCursor(last.CreatedAt, last.ID)
+		nextCursor = &cursor
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Users retrieved successfully",
+		"data": fiber.Map{
+			"users":       users,
+			"next_cursor": nextCursor,
+		},
+	})
+}
+
+// GetUser returns a user with their accounts and cards
+func GetUser(c *fiber.Ctx) error {
+	var user model.User
+	if err := database.DB.First(&user, c.Params("id")).Error; err != nil {
+		return notFound(c, err, "User not found")
+	}
+
+	var accounts []model.BankAccount
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&accounts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve accounts",
+			"data":    nil,
+		})
+	}
+	if err := holds.FillAvailable(database.DB, accounts); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve available balances",
+			"data":    nil,
+		})
+	}
+
+	var cards []model.Card
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&cards).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve cards",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "User retrieved successfully",
+		"data": fiber.Map{
+			"user":     user,
+			"accounts": accounts,
+			"cards":    cards,
+		},
+	})
+}
+
+// SetUserRole changes a user's role. Their tokens are revoked so the new role
+// applies from their next sign in.
+func SetUserRole(c *fiber.Ctx) error {
+	type RoleInput struct {
+		Role model.Role `json:"role"`
+	}
+
+	input := new(RoleInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+	input.Role = model.Role(strings.ToUpper(string(input.Role)))
+	if !input.Role.Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Role must be CUSTOMER, SUPPORT or ADMIN",
+			"data":    nil,
+		})
+	}
+
+	var user model.User
+	if err := database.DB.First(&user, c.Params("id")).Error; err != nil {
+		return notFound(c, err, "User not found")
+	}
+	before := user
+	if user.ID == adminID(c) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You cannot change your own role",
+			"data":    nil,
+		})
+	}
+
+	if err := database.DB.Model(&user).Update("role", input.Role).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not change role",
+			"data":    nil,
+		})
+	}
+	if err := auth.RevokeAllForUser(database.DB, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Role changed but the user's sessions could not be revoked",
+			"data":    nil,
+		})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionRoleChanged, TargetType: "user", TargetID: user.ID, Before: before, After: user})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Role changed successfully",
+		"data":    user,
+	})
+}
+
+// notFound answers 404 for missing records and 500 for other lookup errors
+func notFound(c *fiber.Ctx, err error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": message,
+			"data":    nil,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"status":  "error",
+		"message": "Database error",
+		"data":    nil,
+	})
+}
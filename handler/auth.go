@@ -2,12 +2,15 @@ package handler
 
 import (
 	"errors"
+	"log"
+	"math"
 	"net/mail"
 	"regexp"
+	"strconv"
 	"strings"
-	"time"
 
-	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/auth"
 	"github.com/denver-code/moza-backend/database"
 	"github.com/denver-code/moza-backend/database/model"
 	"github.com/denver-code/moza-backend/util"
@@ -166,6 +169,7 @@ func Register(c *fiber.Ctx) error {
 		Email:    input.Email,
 		Password: hash,
 		FullName: input.FullName,
+		Role:     model.ROLE_CUSTOMER,
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
@@ -176,14 +180,14 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate JWT token
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["username"] = user.Username
-	claims["user_id"] = user.ID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+	audit.Log(c, audit.Event{ActorID: &user.ID, ActorRole: user.Role, Action: audit.ActionRegister, TargetType: "user", TargetID: user.ID, After: user})
+
+	if err := sendVerificationEmail(user, user.Email); err != nil {
+		log.Printf("could not send verification email to user %d: %v", user.ID, err)
+	}
 
-	t, err := token.SignedString([]byte(config.Config("SECRET")))
+	// Start a session with an access and refresh token
+	tokens, err := auth.StartSession(database.DB, user, c.Get(fiber.HeaderUserAgent), c.IP())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -196,7 +200,9 @@ func Register(c *fiber.Ctx) error {
 		"status":  "success",
 		"message": "User created successfully",
 		"data": fiber.Map{
-			"token": t,
+			"token":         tokens.AccessToken,
+			"expires_at":    tokens.ExpiresAt,
+			"refresh_token": tokens.RefreshToken,
 			"user": fiber.Map{
 				"id":        user.ID,
 				"username":  user.Username,
@@ -267,8 +273,25 @@ func Login(c *fiber.Ctx) error {
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": err})
-	} else if userModel == nil {
-		util.CheckPasswordHash(pass, "")
+	}
+
+	// Refuse attempts while the identity or client IP is locked out or delayed
+	throttleKey := auth.IdentityThrottleKey(identity)
+	var userID *uint
+	if userModel != nil {
+		throttleKey = auth.UserThrottleKey(userModel.ID)
+		userID = &userModel.ID
+	}
+	if err := auth.CheckLogin(database.DB, throttleKey, auth.IPThrottleKey(c.IP())); err != nil {
+		return loginThrottled(c, err)
+	}
+
+	if userModel == nil {
+		util.CheckDummyPassword(pass)
+		if err := auth.RecordLoginFailure(database.DB, throttleKey, nil, c.IP()); err != nil {
+			log.Printf("could not record failed login: %v", err)
+		}
+		audit.Log(c, audit.Event{Action: audit.ActionLoginFailed, TargetType: "identity", TargetID: identity})
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid identity or password", "data": err})
 	} else {
 		userData = UserData{
@@ -280,20 +303,148 @@ func Login(c *fiber.Ctx) error {
 	}
 
 	if !util.CheckPasswordHash(pass, userData.Password) {
+		if err := auth.RecordLoginFailure(database.DB, throttleKey, userID, c.IP()); err != nil {
+			log.Printf("could not record failed login: %v", err)
+		}
+		audit.Log(c, audit.Event{Action: audit.ActionLoginFailed, TargetType: "user", TargetID: userModel.ID})
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid identity or password", "data": nil})
 	}
 
-	token := jwt.New(jwt.SigningMethodHS256)
+	// Users with two-factor authentication get a challenge instead of tokens.
+	// Their failed logins are only cleared once the challenge is completed.
+	if userModel.TOTPEnabled {
+		challenge, expiresAt, err := auth.CreateLoginChallenge(database.DB, userModel.ID)
+		if err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.JSON(fiber.Map{"status": "success", "message": "Two-factor authentication required", "data": fiber.Map{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_at":          expiresAt,
+		}})
+	}
+
+	if err := auth.ResetLogin(database.DB, throttleKey); err != nil {
+		log.Printf("could not reset failed logins: %v", err)
+	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["username"] = userData.Username
-	claims["user_id"] = userData.ID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+	tokens, err := auth.StartSession(database.DB, userModel, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	audit.Log(c, audit.Event{ActorID: &userModel.ID, ActorRole: userModel.Role, Action: audit.ActionLogin, TargetType: "session", TargetID: tokens.SessionID})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Success login", "data": tokens})
+}
+
+// loginThrottled answers a login refused by brute-force protection
+func loginThrottled(c *fiber.Ctx, err error) error {
+	var throttle *auth.ThrottleError
+	if !errors.As(err, &throttle) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": nil})
+	}
+
+	seconds := int(math.Ceil(throttle.RetryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+
+	message := "Too many failed attempts, please retry later"
+	if errors.Is(err, auth.ErrLoginLocked) {
+		message = "Too many failed attempts, login temporarily locked"
+	}
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"status": "error", "message": message, "data": fiber.Map{"retry_after": seconds}})
+}
+
+// LoginTwoFactor completes a login challenge with a TOTP or recovery code
+func LoginTwoFactor(c *fiber.Ctx) error {
+	type ChallengeInput struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+	input := new(ChallengeInput)
 
-	t, err := token.SignedString([]byte(config.Config("SECRET")))
+	if err := c.BodyParser(input); err != nil || input.ChallengeToken == "" || input.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Challenge token and code are required", "data": nil})
+	}
+
+	user, err := auth.CompleteLoginChallenge(database.DB, input.ChallengeToken, input.Code, c.IP())
 	if err != nil {
+		var throttle *auth.ThrottleError
+		switch {
+		case errors.As(err, &throttle):
+			return loginThrottled(c, err)
+		case errors.Is(err, auth.ErrInvalidChallenge):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid or expired login challenge", "data": nil})
+		case errors.Is(err, auth.ErrInvalidCode):
+			audit.Log(c, audit.Event{Action: audit.ActionLoginFailed, TargetType: "login_challenge"})
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid two-factor code", "data": nil})
+		}
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	return c.JSON(fiber.Map{"status": "success", "message": "Success login", "data": t})
+	tokens, err := auth.StartSession(database.DB, user, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	audit.Log(c, audit.Event{ActorID: &user.ID, ActorRole: user.Role, Action: audit.ActionLogin, TargetType: "session", TargetID: tokens.SessionID})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Success login", "data": tokens})
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token
+func Refresh(c *fiber.Ctx) error {
+	type RefreshInput struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	input := new(RefreshInput)
+
+	if err := c.BodyParser(input); err != nil || input.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Missing refresh token", "data": nil})
+	}
+
+	tokens, err := auth.Refresh(database.DB, input.RefreshToken, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid or expired refresh token", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't refresh token", "data": nil})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Token refreshed", "data": tokens})
+}
+
+// Logout revokes the session of the current access token
+func Logout(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	sid, ok := claims["sid"].(float64)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Token has no session", "data": nil})
+	}
+
+	if err := auth.RevokeSession(database.DB, uint(sid)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't revoke session", "data": nil})
+	}
+	if err := auth.RevokeToken(database.DB, claims, "logout"); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't revoke token", "data": nil})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionLogout, TargetType: "session", TargetID: uint(sid)})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Logged out", "data": nil})
+}
+
+// LogoutAll revokes every session and token of the user
+func LogoutAll(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	if err := auth.RevokeAllForUser(database.DB, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't revoke sessions", "data": nil})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionLogoutAll, TargetType: "user", TargetID: userID})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Logged out of all sessions", "data": nil})
 }
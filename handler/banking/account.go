@@ -3,11 +3,15 @@ package banking
 import (
 	"time"
 
+	"github.com/denver-code/moza-backend/audit"
 	"github.com/denver-code/moza-backend/database"
 	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/denver-code/moza-backend/payment"
 	"github.com/denver-code/moza-backend/util"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 // CreateBankAccount creates a new bank account for the user
@@ -26,6 +30,14 @@ func CreateBankAccount(c *fiber.Ctx) error {
 		})
 	}
 
+	if !model.Currency(input.Currency).Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Unsupported currency",
+			"data":    nil,
+		})
+	}
+
 	// Get user ID from JWT token
 	user := c.Locals("user").(*jwt.Token)
 	claims := user.Claims.(jwt.MapClaims)
@@ -40,6 +52,7 @@ func CreateBankAccount(c *fiber.Ctx) error {
 		Currency:      model.Currency(input.Currency),
 		AccountNumber: accountNumber,
 		Balance:       0,
+		Status:        model.ACCOUNT_ACTIVE,
 		IsActive:      true,
 		LastActivity:  time.Now(),
 	}
@@ -52,6 +65,8 @@ func CreateBankAccount(c *fiber.Ctx) error {
 		})
 	}
 
+	audit.Log(c, audit.Event{Action: audit.ActionAccountCreated, TargetType: "bank_account", TargetID: account.ID, After: account})
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"status":  "success",
 		"message": "Bank account created successfully",
@@ -74,9 +89,120 @@ func GetUserAccounts(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := holds.FillAvailable(database.DB, accounts); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve available balances",
+			"data":    nil,
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "Accounts retrieved successfully",
 		"data":    accounts,
 	})
 }
+
+// FreezeAccount lets the owner block all money movements, for example after losing a device
+func FreezeAccount(c *fiber.Ctx) error {
+	type FreezeInput struct {
+		Reason string `json:"reason"`
+	}
+
+	input := new(FreezeInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	return changeAccountStatus(c, payment.Freeze, payment.AccountRequest{Reason: input.Reason}, audit.ActionAccountFrozen, "Account frozen successfully")
+}
+
+// UnfreezeAccount lifts a freeze the owner placed
+func UnfreezeAccount(c *fiber.Ctx) error {
+	return changeAccountStatus(c, payment.Unfreeze, payment.AccountRequest{}, audit.ActionAccountUnfrozen, "Account unfrozen successfully")
+}
+
+func changeAccountStatus(c *fiber.Ctx, change func(*gorm.DB, payment.AccountRequest) (*model.BankAccount, error), req payment.AccountRequest, action, success string) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid account ID",
+			"data":    nil,
+		})
+	}
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	req.ActorID = uint(claims["user_id"].(float64))
+	req.AccountID = uint(id)
+
+	account, err := change(database.DB, req)
+	if err != nil {
+		return paymentError(c, err, "Could not update account")
+	}
+
+	audit.Log(c, audit.Event{Action: action, TargetType: "bank_account", TargetID: account.ID, After: account})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": success,
+		"data":    account,
+	})
+}
+
+// CloseAccount permanently closes an account. Any remaining balance is moved to
+// sweep_account_id, which must be another active account of the user.
+func CloseAccount(c *fiber.Ctx) error {
+	type CloseInput struct {
+		Reason         string `json:"reason"`
+		SweepAccountID *uint  `json:"sweep_account_id"`
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid account ID",
+			"data":    nil,
+		})
+	}
+
+	input := new(CloseInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	closure, err := payment.Close(database.DB, payment.AccountRequest{
+		ActorID:        userID,
+		AccountID:      uint(id),
+		Reason:         input.Reason,
+		SweepAccountID: input.SweepAccountID,
+	})
+	if err != nil {
+		return paymentError(c, err, "Could not close account")
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionAccountClosed, TargetType: "bank_account", TargetID: closure.BankAccountID, After: closure})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Account closed successfully",
+		"data":    closure,
+	})
+}
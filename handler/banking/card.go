@@ -2,10 +2,17 @@ package banking
 
 import (
 	"errors"
-	"time"
+	"log"
+	"math"
+	"strconv"
+	"strings"
 
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/cards"
 	"github.com/denver-code/moza-backend/database"
 	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/money"
 	"github.com/denver-code/moza-backend/util"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -15,9 +22,9 @@ import (
 // CreateCard creates a new card for a bank account
 func CreateCard(c *fiber.Ctx) error {
 	type CardInput struct {
-		BankAccountID uint    `json:"bank_account_id"`
-		CardType      string  `json:"card_type"`
-		DailyLimit    float64 `json:"daily_limit"`
+		BankAccountID uint         `json:"bank_account_id"`
+		CardType      string       `json:"card_type"`   // VISA, MASTERCARD, etc., see cards.Schemes
+		DailyLimit    money.Amount `json:"daily_limit"` // in minor units of the account currency
 	}
 
 	input := new(CardInput)
@@ -29,51 +36,30 @@ func CreateCard(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get user ID from JWT token
-	user := c.Locals("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-	userID := uint(claims["user_id"].(float64))
-
-	// Verify bank account ownership
-	var account model.BankAccount
-	if err := database.DB.Where("id = ? AND user_id = ?", input.BankAccountID, userID).First(&account).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"status":  "error",
-				"message": "Bank account not found or unauthorized",
-				"data":    nil,
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	if input.DailyLimit < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Could not verify bank account",
+			"message": "Daily limit cannot be negative",
 			"data":    nil,
 		})
 	}
 
-	// Generate card details
-	cardNumber := util.GenerateCardNumber()
-	cvv := util.GenerateCVV()
-	expiryDate := time.Now().AddDate(4, 0, 0) // 4 years validity
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
 
-	card := &model.Card{
+	card, err := cards.Issue(database.DB, cards.IssueRequest{
 		UserID:        userID,
 		BankAccountID: input.BankAccountID,
-		CardNumber:    cardNumber,
-		ExpiryDate:    expiryDate,
-		CVV:           cvv,
-		IsActive:      true,
-		DailyLimit:    input.DailyLimit,
 		CardType:      input.CardType,
+		DailyLimit:    input.DailyLimit,
+	})
+	if err != nil {
+		return cardError(c, err, "Could not create card")
 	}
 
-	if err := database.DB.Create(&card).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Could not create card",
-			"data":    nil,
-		})
-	}
+	audit.Log(c, audit.Event{Action: audit.ActionCardCreated, TargetType: "card", TargetID: card.ID, After: audit.CardSnapshot(card)})
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"status":  "success",
@@ -109,8 +95,8 @@ func GetCards(c *fiber.Ctx) error {
 		})
 	}
 
-	var cards []model.Card
-	if err := database.DB.Where("bank_account_id = ?", accountID).Find(&cards).Error; err != nil {
+	var accountCards []model.Card
+	if err := database.DB.Where("bank_account_id = ?", accountID).Find(&accountCards).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Could not retrieve cards",
@@ -121,6 +107,270 @@ func GetCards(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "Cards retrieved successfully",
-		"data":    cards,
+		"data":    accountCards,
+	})
+}
+
+// GetCardAuthorizations lists the authorizations merchants requested on one of the
+// user's cards, newest first, including declined ones
+func GetCardAuthorizations(c *fiber.Ctx) error {
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	var card model.Card
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&card).Error; err != nil {
+		return cardError(c, cards.ErrCardNotFound, "Could not verify card")
+	}
+
+	var authorizations []model.CardAuthorization
+	if err := database.DB.Where("card_id = ?", card.ID).
+		Order("created_at DESC").
+		Limit(100).
+		Find(&authorizations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve card authorizations",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Card authorizations retrieved successfully",
+		"data":    authorizations,
+	})
+}
+
+// RevealCard returns the full number and CVV of one of the user's cards. Lists only
+// show masked numbers, so the password is asked for again before the details are decrypted.
+func RevealCard(c *fiber.Ctx) error {
+	type RevealInput struct {
+		Password string `json:"password"`
+	}
+
+	cardID, err := c.ParamsInt("id")
+	if err != nil || cardID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid card ID",
+			"data":    nil,
+		})
+	}
+
+	input := new(RevealInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	// Wrong passwords count towards the login throttle so a stolen token cannot guess it
+	throttleKey := auth.UserThrottleKey(userID)
+	if err := auth.CheckLogin(database.DB, throttleKey, auth.IPThrottleKey(c.IP())); err != nil {
+		var throttle *auth.ThrottleError
+		if !errors.As(err, &throttle) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": nil})
+		}
+		seconds := int(math.Ceil(throttle.RetryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Too many failed attempts, please retry later",
+			"data":    fiber.Map{"retry_after": seconds},
+		})
+	}
+
+	var owner model.User
+	if err := database.DB.First(&owner, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "User not found",
+			"data":    nil,
+		})
+	}
+	if !util.CheckPasswordHash(input.Password, owner.Password) {
+		if err := auth.RecordLoginFailure(database.DB, throttleKey, &userID, c.IP()); err != nil {
+			log.Printf("could not record failed password check: %v", err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Password is incorrect",
+			"data":    nil,
+		})
+	}
+
+	card, err := cards.Reveal(database.DB, userID, uint(cardID))
+	if err != nil {
+		return cardError(c, err, "Could not reveal card details")
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionCardRevealed, TargetType: "card", TargetID: card.ID, After: audit.CardSnapshot(card)})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Card details retrieved successfully",
+		"data": fiber.Map{
+			"id":          card.ID,
+			"card_number": card.CardNumber,
+			"cvv":         card.CVV,
+			"expiry_date": card.ExpiryDate,
+		},
+	})
+}
+
+// FreezeCard temporarily blocks one of the user's cards
+func FreezeCard(c *fiber.Ctx) error {
+	return changeCard(c, cards.Freeze, audit.ActionCardFrozen, "Card frozen successfully", "Could not freeze card")
+}
+
+// UnfreezeCard lifts a freeze the user placed on a card
+func UnfreezeCard(c *fiber.Ctx) error {
+	return changeCard(c, cards.Unfreeze, audit.ActionCardUnfrozen, "Card unfrozen successfully", "Could not unfreeze card")
+}
+
+// CancelCard permanently blocks a card, for example when it was lost or stolen
+func CancelCard(c *fiber.Ctx) error {
+	return changeCard(c, cards.Cancel, audit.ActionCardCancelled, "Card cancelled successfully", "Could not cancel card")
+}
+
+func changeCard(c *fiber.Ctx, change func(*gorm.DB, cards.Request) (*model.Card, error), action, success, failure string) error {
+	req, invalid := cardRequest(c)
+	if invalid != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": invalid,
+			"data":    nil,
+		})
+	}
+
+	var before model.Card
+	database.DB.First(&before, req.CardID)
+
+	card, err := change(database.DB, *req)
+	if err != nil {
+		return cardError(c, err, failure)
+	}
+
+	audit.Log(c, audit.Event{Action: action, TargetType: "card", TargetID: card.ID, Before: audit.CardSnapshot(&before), After: audit.CardSnapshot(card)})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": success,
+		"data":    card,
+	})
+}
+
+// ReplaceCard issues a new card with the limits and settings of an old one, which
+// is cancelled with the given reason and linked to its replacement
+func ReplaceCard(c *fiber.Ctx) error {
+	req, invalid := cardRequest(c)
+	if invalid != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": invalid,
+			"data":    nil,
+		})
+	}
+
+	old, replacement, err := cards.Replace(database.DB, *req)
+	if err != nil {
+		return cardError(c, err, "Could not replace card")
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionCardCancelled, TargetType: "card", TargetID: old.ID, After: audit.CardSnapshot(old)})
+	audit.Log(c, audit.Event{Action: audit.ActionCardReplaced, TargetType: "card", TargetID: replacement.ID, After: audit.CardSnapshot(replacement)})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Card replaced successfully",
+		"data": fiber.Map{
+			"card":          replacement,
+			"replaced_card": old,
+		},
+	})
+}
+
+// cardRequest reads the card ID and optional cancellation reason of a lifecycle
+// request, or returns why the request is invalid
+func cardRequest(c *fiber.Ctx) (*cards.Request, string) {
+	type CardActionInput struct {
+		Reason model.CardCancelReason `json:"reason"` // cancellation and replacement only
+		Note   string                 `json:"note"`
+	}
+
+	cardID, err := c.ParamsInt("id")
+	if err != nil || cardID <= 0 {
+		return nil, "Invalid card ID"
+	}
+
+	input := new(CardActionInput)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(input); err != nil {
+			return nil, "Invalid input"
+		}
+	}
+	if len(input.Note) > 255 {
+		return nil, "Note must be at most 255 characters"
+	}
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	return &cards.Request{
+		ActorID: userID,
+		CardID:  uint(cardID),
+		Reason:  input.Reason,
+		Note:    input.Note,
+	}, ""
+}
+
+// cardError maps card errors to HTTP responses
+func cardError(c *fiber.Ctx, err error, fallback string) error {
+	status, message := fiber.StatusInternalServerError, fallback
+
+	switch {
+	case errors.Is(err, cards.ErrCardNotFound):
+		status, message = fiber.StatusNotFound, "Card not found or unauthorized"
+	case errors.Is(err, cards.ErrAccountNotFound):
+		status, message = fiber.StatusNotFound, "Bank account not found or unauthorized"
+	case errors.Is(err, cards.ErrAccountInactive):
+		status, message = fiber.StatusForbidden, "Bank account is frozen or closed"
+	case errors.Is(err, cards.ErrInvalidLimit):
+		status, message = fiber.StatusBadRequest, "Daily limit cannot be negative"
+	case errors.Is(err, cards.ErrInvalidCardType):
+		status, message = fiber.StatusBadRequest, "Card type must be one of "+strings.Join(cards.Schemes(), ", ")
+	case errors.Is(err, cards.ErrNumbersExhausted):
+		status, message = fiber.StatusServiceUnavailable, "No card numbers are available for this card type"
+	case errors.Is(err, cards.ErrInvalidReason):
+		status, message = fiber.StatusBadRequest, "Reason must be LOST, STOLEN, DAMAGED, EXPIRED or OTHER"
+	case errors.Is(err, cards.ErrCardFrozen):
+		status, message = fiber.StatusConflict, "Card is frozen"
+	case errors.Is(err, cards.ErrCardCancelled):
+		status, message = fiber.StatusConflict, "Card is cancelled"
+	case errors.Is(err, cards.ErrCardNotFrozen):
+		status, message = fiber.StatusConflict, "Card is not frozen"
+	case errors.Is(err, cards.ErrFrozenByStaff):
+		status, message = fiber.StatusForbidden, "Card was frozen by staff, please contact support"
+	case errors.Is(err, cards.ErrCancelledByStaff):
+		status, message = fiber.StatusForbidden, "Card was cancelled by staff, please contact support"
+	case errors.Is(err, cards.ErrAlreadyReplaced):
+		status, message = fiber.StatusConflict, "Card was already replaced"
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+		"data":    nil,
 	})
 }
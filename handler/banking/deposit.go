@@ -0,0 +1,69 @@
+package banking
+
+import (
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/payment"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// ExternalInput is the body of deposit and withdrawal requests
+type ExternalInput struct {
+	AccountID           uint         `json:"account_id"`
+	Amount              money.Amount `json:"amount"` // in minor units of the account currency
+	Description         string       `json:"description"`
+	CounterpartyName    string       `json:"counterparty_name"`
+	CounterpartyAccount string       `json:"counterparty_account"`
+	ExternalReference   string       `json:"external_reference"`
+}
+
+// Deposit tops up an account from an external bank account
+func Deposit(c *fiber.Ctx) error {
+	return external(c, payment.Deposit, audit.ActionDeposit, "Deposit completed successfully", "Could not complete deposit")
+}
+
+// Withdraw sends money from an account to an external bank account
+func Withdraw(c *fiber.Ctx) error {
+	return external(c, payment.Withdraw, audit.ActionWithdrawal, "Withdrawal completed successfully", "Could not complete withdrawal")
+}
+
+func external(c *fiber.Ctx, move func(*gorm.DB, payment.ExternalRequest) (*model.Transaction, error), action, success, failure string) error {
+	input := new(ExternalInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	transaction, err := move(database.DB, payment.ExternalRequest{
+		UserID:              userID,
+		AccountID:           input.AccountID,
+		Amount:              input.Amount,
+		Description:         input.Description,
+		CounterpartyName:    input.CounterpartyName,
+		CounterpartyAccount: input.CounterpartyAccount,
+		ExternalReference:   input.ExternalReference,
+	})
+	if err != nil {
+		return paymentError(c, err, failure)
+	}
+
+	audit.Log(c, audit.Event{Action: action, TargetType: "transaction", TargetID: transaction.ID, After: transaction})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": success,
+		"data":    transaction,
+	})
+}
@@ -0,0 +1,96 @@
+package banking
+
+import (
+	"errors"
+
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/fx"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GetExchangeRates lists the current mid-market rates and spreads
+func GetExchangeRates(c *fiber.Ctx) error {
+	var rates []model.ExchangeRate
+	if err := database.DB.Order("from_currency, to_currency").Find(&rates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve exchange rates",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Exchange rates retrieved successfully",
+		"data":    rates,
+	})
+}
+
+// CreateQuote locks an exchange rate for a conversion for a short period
+func CreateQuote(c *fiber.Ctx) error {
+	type QuoteInput struct {
+		FromCurrency model.Currency `json:"from_currency"`
+		ToCurrency   model.Currency `json:"to_currency"`
+		Amount       money.Amount   `json:"amount"` // in minor units of the source currency
+	}
+
+	input := new(QuoteInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	if input.Amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Amount must be positive",
+			"data":    nil,
+		})
+	}
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	quote, err := fx.CreateQuote(database.DB, userID, input.Amount, input.FromCurrency, input.ToCurrency)
+	if err != nil {
+		switch {
+		case errors.Is(err, fx.ErrInvalidPair):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid currency pair",
+				"data":    nil,
+			})
+		case errors.Is(err, fx.ErrRateNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "No exchange rate available for this currency pair",
+				"data":    nil,
+			})
+		case errors.Is(err, money.ErrAmountOverflow):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Amount is too large to convert",
+				"data":    nil,
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not create quote",
+			"data":    nil,
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Quote created successfully",
+		"data":    quote,
+	})
+}
@@ -0,0 +1,62 @@
+package banking
+
+import (
+	"time"
+
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GetAccountHolds returns the ledger and available balance of an account with the
+// active holds that make up the difference
+func GetAccountHolds(c *fiber.Ctx) error {
+	accountID := c.Params("id")
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	// Verify account ownership
+	var account model.BankAccount
+	if err := database.DB.Where("id = ? AND user_id = ?", accountID, userID).First(&account).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Unauthorized or account not found",
+			"data":    nil,
+		})
+	}
+
+	var activeHolds []model.Hold
+	if err := database.DB.Where("bank_account_id = ? AND status = ? AND expires_at > ?", account.ID, model.HOLD_ACTIVE, time.Now()).
+		Order("created_at desc").
+		Find(&activeHolds).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve holds",
+			"data":    nil,
+		})
+	}
+
+	available, err := holds.Available(database.DB, &account)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not compute available balance",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Holds retrieved successfully",
+		"data": fiber.Map{
+			"ledger_balance":    account.Balance,
+			"available_balance": available,
+			"holds":             activeHolds,
+		},
+	})
+}
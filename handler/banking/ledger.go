@@ -0,0 +1,60 @@
+package banking
+
+import (
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GetAccountLedger returns the postings of an account and reconciles its cached balance
+func GetAccountLedger(c *fiber.Ctx) error {
+	accountID := c.Params("id")
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	// Verify account ownership
+	var account model.BankAccount
+	if err := database.DB.Where("id = ? AND user_id = ?", accountID, userID).First(&account).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Unauthorized or account not found",
+			"data":    nil,
+		})
+	}
+
+	var postings []model.Posting
+	if err := database.DB.Where("bank_account_id = ?", account.ID).
+		Order("created_at desc").
+		Find(&postings).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve ledger postings",
+			"data":    nil,
+		})
+	}
+
+	ledgerBalance, err := ledger.Balance(database.DB, account.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not compute ledger balance",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Ledger retrieved successfully",
+		"data": fiber.Map{
+			"cached_balance": account.Balance,
+			"ledger_balance": ledgerBalance,
+			"balanced":       account.Balance == ledgerBalance,
+			"postings":       postings,
+		},
+	})
+}
@@ -0,0 +1,191 @@
+package banking
+
+import (
+	"errors"
+	"time"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/payment"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// CreatePot creates a pot inside one of the user's bank accounts
+func CreatePot(c *fiber.Ctx) error {
+	type PotInput struct {
+		Name        string       `json:"name"`
+		GoalAmount  money.Amount `json:"goal_amount"` // in minor units of the account currency
+		LockedUntil *time.Time   `json:"locked_until"`
+	}
+
+	accountID := c.Params("id")
+
+	input := new(PotInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	if input.Name == "" || len(input.Name) > 50 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Pot name must be between 1 and 50 characters",
+			"data":    nil,
+		})
+	}
+
+	if input.GoalAmount < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Goal amount cannot be negative",
+			"data":    nil,
+		})
+	}
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	// Verify bank account ownership
+	var account model.BankAccount
+	if err := database.DB.Where("id = ? AND user_id = ?", accountID, userID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Bank account not found or unauthorized",
+				"data":    nil,
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not verify bank account",
+			"data":    nil,
+		})
+	}
+
+	if account.Status != model.ACCOUNT_ACTIVE {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Bank account is frozen or closed",
+			"data":    nil,
+		})
+	}
+
+	pot := &model.Pot{
+		UserID:        userID,
+		BankAccountID: account.ID,
+		Name:          input.Name,
+		Currency:      account.Currency,
+		GoalAmount:    input.GoalAmount,
+		LockedUntil:   input.LockedUntil,
+	}
+
+	if err := database.DB.Create(&pot).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not create pot",
+			"data":    nil,
+		})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionPotCreated, TargetType: "pot", TargetID: pot.ID, After: pot})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Pot created successfully",
+		"data":    pot,
+	})
+}
+
+// GetPots retrieves all pots of the user bank account
+func GetPots(c *fiber.Ctx) error {
+	accountID := c.Params("id")
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	var pots []model.Pot
+	if err := database.DB.Where("bank_account_id = ? AND user_id = ?", accountID, userID).
+		Order("created_at").
+		Find(&pots).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve pots",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Pots retrieved successfully",
+		"data":    pots,
+	})
+}
+
+// DepositToPot moves money from the account into the pot
+func DepositToPot(c *fiber.Ctx) error {
+	return movePot(c, payment.MoveToPot, audit.ActionPotDeposit, "Money added to pot successfully", "Could not add money to pot")
+}
+
+// WithdrawFromPot moves money from the pot back into the account
+func WithdrawFromPot(c *fiber.Ctx) error {
+	return movePot(c, payment.MoveFromPot, audit.ActionPotWithdrawal, "Money withdrawn from pot successfully", "Could not withdraw money from pot")
+}
+
+func movePot(c *fiber.Ctx, move func(*gorm.DB, payment.PotRequest) (*model.Transaction, error), action, success, failure string) error {
+	type PotMoveInput struct {
+		Amount      money.Amount `json:"amount"` // in minor units of the pot currency
+		Description string       `json:"description"`
+	}
+
+	potID, err := c.ParamsInt("id")
+	if err != nil || potID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid pot ID",
+			"data":    nil,
+		})
+	}
+
+	input := new(PotMoveInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	transaction, err := move(database.DB, payment.PotRequest{
+		UserID:      userID,
+		PotID:       uint(potID),
+		Amount:      input.Amount,
+		Description: input.Description,
+	})
+	if err != nil {
+		return paymentError(c, err, failure)
+	}
+
+	audit.Log(c, audit.Event{Action: action, TargetType: "transaction", TargetID: transaction.ID, After: transaction})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": success,
+		"data":    transaction,
+	})
+}
@@ -0,0 +1,280 @@
+package banking
+
+import (
+	"errors"
+	"time"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/scheduler"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateScheduledPayment schedules a future-dated or recurring transfer
+func CreateScheduledPayment(c *fiber.Ctx) error {
+	type ScheduleInput struct {
+		FromAccountID uint            `json:"from_account_id"`
+		ToAccountID   uint            `json:"to_account_id"`
+		Amount        money.Amount    `json:"amount"` // in minor units of the source currency
+		Description   string          `json:"description"`
+		Frequency     model.Frequency `json:"frequency"`
+		IntervalDays  int             `json:"interval_days"` // required for CUSTOM
+		StartDate     time.Time       `json:"start_date"`
+		EndDate       *time.Time      `json:"end_date"`
+	}
+
+	input := new(ScheduleInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	if input.Amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Amount must be positive",
+			"data":    nil,
+		})
+	}
+
+	if input.FromAccountID == input.ToAccountID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Cannot transfer to the same account",
+			"data":    nil,
+		})
+	}
+
+	switch input.Frequency {
+	case model.ONCE, model.WEEKLY, model.MONTHLY:
+		input.IntervalDays = 0
+	case model.CUSTOM:
+		if input.IntervalDays < 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Custom schedules need an interval of at least one day",
+				"data":    nil,
+			})
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Frequency must be ONCE, WEEKLY, MONTHLY or CUSTOM",
+			"data":    nil,
+		})
+	}
+
+	if input.StartDate.IsZero() || input.StartDate.Before(time.Now().Add(-time.Minute)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Start date must be in the future",
+			"data":    nil,
+		})
+	}
+
+	if input.EndDate != nil && input.EndDate.Before(input.StartDate) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "End date must be after the start date",
+			"data":    nil,
+		})
+	}
+
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	// Verify ownership of the source account and that the destination exists
+	var fromAccount model.BankAccount
+	if err := database.DB.Where("id = ? AND user_id = ?", input.FromAccountID, userID).First(&fromAccount).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Unauthorized or account not found",
+			"data":    nil,
+		})
+	}
+
+	var toAccount model.BankAccount
+	if err := database.DB.First(&toAccount, input.ToAccountID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Destination account not found",
+			"data":    nil,
+		})
+	}
+
+	// Frozen accounts may still get schedules that run once they are unfrozen
+	if fromAccount.Status == model.ACCOUNT_CLOSED || toAccount.Status == model.ACCOUNT_CLOSED {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Account is closed",
+			"data":    nil,
+		})
+	}
+
+	schedule := &model.ScheduledPayment{
+		UserID:          userID,
+		FromAccountID:   fromAccount.ID,
+		ToAccountID:     toAccount.ID,
+		Amount:          input.Amount,
+		Description:     input.Description,
+		Frequency:       input.Frequency,
+		IntervalDays:    input.IntervalDays,
+		StartDate:       input.StartDate,
+		EndDate:         input.EndDate,
+		Status:          model.SCHEDULE_ACTIVE,
+		NextPaymentDate: input.StartDate,
+		NextAttemptAt:   input.StartDate,
+	}
+
+	if err := database.DB.Create(&schedule).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not create scheduled payment",
+			"data":    nil,
+		})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionScheduleCreated, TargetType: "scheduled_payment", TargetID: schedule.ID, After: schedule})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Scheduled payment created successfully",
+		"data":    schedule,
+	})
+}
+
+// GetScheduledPayments lists the user's scheduled payments
+func GetScheduledPayments(c *fiber.Ctx) error {
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	var schedules []model.ScheduledPayment
+	if err := database.DB.Where("user_id = ?", userID).
+		Order("next_payment_date").
+		Find(&schedules).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve scheduled payments",
+			"data":    nil,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Scheduled payments retrieved successfully",
+		"data":    schedules,
+	})
+}
+
+// PauseScheduledPayment stops a schedule from running until it is resumed
+func PauseScheduledPayment(c *fiber.Ctx) error {
+	return updateSchedule(c, model.SCHEDULE_ACTIVE, model.SCHEDULE_PAUSED, "Scheduled payment paused successfully")
+}
+
+// ResumeScheduledPayment restarts a paused schedule from its next future occurrence
+func ResumeScheduledPayment(c *fiber.Ctx) error {
+	return updateSchedule(c, model.SCHEDULE_PAUSED, model.SCHEDULE_ACTIVE, "Scheduled payment resumed successfully")
+}
+
+// CancelScheduledPayment permanently stops a schedule
+func CancelScheduledPayment(c *fiber.Ctx) error {
+	return updateSchedule(c, "", model.SCHEDULE_CANCELLED, "Scheduled payment cancelled successfully")
+}
+
+// updateSchedule moves a schedule owned by the user from one status to another.
+// An empty from status accepts any schedule that is still active or paused.
+func updateSchedule(c *fiber.Ctx, from, to model.ScheduleStatus, success string) error {
+	// Get user ID from JWT token
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	var schedule, before model.ScheduledPayment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the row so a change cannot overwrite a run the scheduler just committed
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&schedule).Error; err != nil {
+			return err
+		}
+		before = schedule
+
+		allowed := schedule.Status == from
+		if from == "" {
+			allowed = schedule.Status == model.SCHEDULE_ACTIVE || schedule.Status == model.SCHEDULE_PAUSED
+		}
+		if !allowed {
+			return errInvalidScheduleState
+		}
+
+		schedule.Status = to
+		if to == model.SCHEDULE_ACTIVE {
+			scheduler.SkipMissed(&schedule, time.Now())
+		}
+
+		// Only the columns a status change touches are written, guarded by the status read
+		result := tx.Model(&model.ScheduledPayment{}).
+			Where("id = ? AND status = ?", schedule.ID, before.Status).
+			Updates(map[string]any{
+				"status":            schedule.Status,
+				"occurrences":       schedule.Occurrences,
+				"failed_attempts":   schedule.FailedAttempts,
+				"next_payment_date": schedule.NextPaymentDate,
+				"next_attempt_at":   schedule.NextAttemptAt,
+				"updated_at":        time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidScheduleState
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Scheduled payment not found or unauthorized",
+				"data":    nil,
+			})
+		case errors.Is(err, errInvalidScheduleState):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Scheduled payment cannot be changed in its current status",
+				"data":    nil,
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not update scheduled payment",
+			"data":    nil,
+		})
+	}
+
+	action := audit.ActionScheduleUpdated
+	if to == model.SCHEDULE_CANCELLED {
+		action = audit.ActionScheduleCancelled
+	}
+	audit.Log(c, audit.Event{Action: action, TargetType: "scheduled_payment", TargetID: schedule.ID, Before: before, After: schedule})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": success,
+		"data":    schedule,
+	})
+}
+
+var errInvalidScheduleState = errors.New("scheduled payment cannot be changed in its current status")
@@ -1,20 +1,32 @@
 package banking
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denver-code/moza-backend/audit"
 	"github.com/denver-code/moza-backend/database"
 	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/fx"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/payment"
 	"github.com/denver-code/moza-backend/util"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 // Transfer handles money transfer between accounts
 func Transfer(c *fiber.Ctx) error {
 	type TransferInput struct {
-		FromAccountID uint    `json:"from_account_id"`
-		ToAccountID   uint    `json:"to_account_id"`
-		Amount        float64 `json:"amount"`
-		Description   string  `json:"description"`
+		FromAccountID uint         `json:"from_account_id"`
+		ToAccountID   uint         `json:"to_account_id"`
+		Amount        money.Amount `json:"amount"` // in minor units of the source currency
+		Description   string       `json:"description"`
+		QuoteID       *uint        `json:"quote_id"` // optional FX quote locking the rate
 	}
 
 	input := new(TransferInput)
@@ -26,102 +38,24 @@ func Transfer(c *fiber.Ctx) error {
 		})
 	}
 
-	if input.FromAccountID == input.ToAccountID {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Cannot transfer to the same account",
-			"data":    nil,
-		})
-	}
-
 	// Get user ID from JWT token
 	user := c.Locals("user").(*jwt.Token)
 	claims := user.Claims.(jwt.MapClaims)
 	userID := uint(claims["user_id"].(float64))
 
-	// Start transaction
-	tx := database.DB.Begin()
-
-	// Verify ownership and get source account
-	var fromAccount model.BankAccount
-	if err := tx.Where("id = ? AND user_id = ?", input.FromAccountID, userID).First(&fromAccount).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Unauthorized or account not found",
-			"data":    nil,
-		})
-	}
-
-	// Check sufficient balance
-	if fromAccount.Balance < input.Amount {
-		tx.Rollback()
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Insufficient balance",
-			"data":    nil,
-		})
-	}
-
-	// Get destination account
-	var toAccount model.BankAccount
-	if err := tx.Where("id = ?", input.ToAccountID).First(&toAccount).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Destination account not found",
-			"data":    nil,
-		})
-	}
-
-	// Update balances
-	if err := tx.Model(&fromAccount).Update("balance", fromAccount.Balance-input.Amount).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Could not update source account",
-			"data":    nil,
-		})
-	}
-
-	if err := tx.Model(&toAccount).Update("balance", toAccount.Balance+input.Amount).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Could not update destination account",
-			"data":    nil,
-		})
-	}
-
-	// Create transaction record
-	transaction := &model.Transaction{
+	transaction, err := payment.Transfer(database.DB, payment.TransferRequest{
+		UserID:        userID,
 		FromAccountID: input.FromAccountID,
 		ToAccountID:   input.ToAccountID,
 		Amount:        input.Amount,
-		Currency:      fromAccount.Currency,
 		Description:   input.Description,
-		Type:          "TRANSFER",
-		Status:        "COMPLETED",
-		Reference:     util.GenerateTransactionReference(),
+		QuoteID:       input.QuoteID,
+	})
+	if err != nil {
+		return paymentError(c, err, "Could not complete transfer")
 	}
 
-	if err := tx.Create(&transaction).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Could not create transaction record",
-			"data":    nil,
-		})
-	}
-
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Could not complete transfer",
-			"data":    nil,
-		})
-	}
+	audit.Log(c, audit.Event{Action: audit.ActionTransfer, TargetType: "transaction", TargetID: transaction.ID, After: transaction})
 
 	return c.JSON(fiber.Map{
 		"status":  "success",
@@ -130,7 +64,71 @@ func Transfer(c *fiber.Ctx) error {
 	})
 }
 
-// GetAccountTransactions retrieves transactions for a specific account
+// paymentError maps payment engine errors to API responses
+func paymentError(c *fiber.Ctx, err error, fallback string) error {
+	status, message := fiber.StatusInternalServerError, fallback
+
+	switch {
+	case errors.Is(err, payment.ErrInvalidAmount):
+		status, message = fiber.StatusBadRequest, "Amount must be positive"
+	case errors.Is(err, payment.ErrSameAccount):
+		status, message = fiber.StatusBadRequest, "Cannot transfer to the same account"
+	case errors.Is(err, payment.ErrSourceNotFound), errors.Is(err, payment.ErrAccountNotFound):
+		status, message = fiber.StatusUnauthorized, "Unauthorized or account not found"
+	case errors.Is(err, payment.ErrDestinationNotFound):
+		status, message = fiber.StatusNotFound, "Destination account not found"
+	case errors.Is(err, payment.ErrInsufficientFunds):
+		status, message = fiber.StatusBadRequest, "Insufficient balance"
+	case errors.Is(err, payment.ErrCounterpartyRequired):
+		status, message = fiber.StatusBadRequest, "Counterparty name and account are required"
+	case errors.Is(err, payment.ErrExternalRefDuplicated):
+		status, message = fiber.StatusConflict, "External reference was already processed"
+	case errors.Is(err, payment.ErrPotNotFound):
+		status, message = fiber.StatusNotFound, "Pot not found or unauthorized"
+	case errors.Is(err, payment.ErrPotLocked):
+		status, message = fiber.StatusForbidden, "Pot is locked"
+	case errors.Is(err, payment.ErrAmountTooSmall):
+		status, message = fiber.StatusBadRequest, "Amount is too small to convert"
+	case errors.Is(err, payment.ErrAccountFrozen):
+		status, message = fiber.StatusForbidden, "Account is frozen"
+	case errors.Is(err, payment.ErrAccountClosed):
+		status, message = fiber.StatusConflict, "Account is closed"
+	case errors.Is(err, payment.ErrDestinationInactive):
+		status, message = fiber.StatusBadRequest, "Destination account cannot receive payments"
+	case errors.Is(err, payment.ErrAccountNotFrozen):
+		status, message = fiber.StatusConflict, "Account is not frozen"
+	case errors.Is(err, payment.ErrFrozenByStaff):
+		status, message = fiber.StatusForbidden, "Account was frozen by our staff, please contact support"
+	case errors.Is(err, payment.ErrPotsNotEmpty):
+		status, message = fiber.StatusConflict, "Empty the account's pots before closing it"
+	case errors.Is(err, payment.ErrFundsOnHold):
+		status, message = fiber.StatusConflict, "Wait for funds on hold to be released before closing the account"
+	case errors.Is(err, payment.ErrSweepRequired):
+		status, message = fiber.StatusBadRequest, "A sweep account is required to close an account with a balance"
+	case errors.Is(err, payment.ErrInvalidSweepAccount):
+		status, message = fiber.StatusBadRequest, "Sweep account must be another active account of the same owner"
+	case errors.Is(err, payment.ErrReasonRequired):
+		status, message = fiber.StatusBadRequest, "A reason is required"
+	case errors.Is(err, fx.ErrInvalidQuote):
+		status, message = fiber.StatusBadRequest, "Exchange quote is invalid or expired"
+	case errors.Is(err, fx.ErrRateNotFound):
+		status, message = fiber.StatusBadRequest, "No exchange rate available for this currency pair"
+	case errors.Is(err, money.ErrAmountOverflow):
+		status, message = fiber.StatusBadRequest, "Amount is too large to convert"
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+		"data":    nil,
+	})
+}
+
+// GetAccountTransactions retrieves transactions for a specific account.
+// Results are returned newest first in pages, pass next_cursor back as cursor to
+// get the following page. Supported filters: from, to (RFC 3339 dates), min_amount,
+// max_amount (minor units), type, status, direction (in or out), counterparty_account_id,
+// counterparty (external name or account) and q (text search in the description).
 func GetAccountTransactions(c *fiber.Ctx) error {
 	accountID := c.Params("id")
 
@@ -149,9 +147,49 @@ func GetAccountTransactions(c *fiber.Ctx) error {
 		})
 	}
 
+	return ListAccountTransactions(c, &account)
+}
+
+// ListAccountTransactions writes a page of the account's transactions using the
+// query string parameters described on GetAccountTransactions. Callers check access.
+func ListAccountTransactions(c *fiber.Ctx, account *model.BankAccount) error {
+	limit := c.QueryInt("limit", util.DefaultPageSize)
+	if limit < 1 || limit > util.MaxPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Limit must be between 1 and %d", util.MaxPageSize),
+			"data":    nil,
+		})
+	}
+
+	query := database.DB.Model(&model.Transaction{}).
+		Where("from_account_id = ? OR to_account_id = ?", account.ID, account.ID)
+
+	query, err := filterTransactions(c, query, account.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+			"data":    nil,
+		})
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		createdAt, id, err := util.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid cursor",
+				"data":    nil,
+			})
+		}
+		query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+	}
+
+	// Fetch one extra row to know whether another page exists
 	var transactions []model.Transaction
-	if err := database.DB.Where("from_account_id = ? OR to_account_id = ?", accountID, accountID).
-		Order("created_at desc").
+	if err := query.Order("created_at desc, id desc").
+		Limit(limit + 1).
 		Find(&transactions).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
@@ -160,9 +198,89 @@ func GetAccountTransactions(c *fiber.Ctx) error {
 		})
 	}
 
+	var nextCursor *string
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		cursor := util.EncodeCursor(last.CreatedAt, last.ID)
+		nextCursor = &cursor
+	}
+
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "Transactions retrieved successfully",
-		"data":    transactions,
+		"data": fiber.Map{
+			"transactions": transactions,
+			"next_cursor":  nextCursor,
+		},
 	})
 }
+
+// filterTransactions applies the optional query string filters of GetAccountTransactions
+func filterTransactions(c *fiber.Ctx, query *gorm.DB, accountID uint) (*gorm.DB, error) {
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, errors.New("from must be an RFC 3339 date")
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, errors.New("to must be an RFC 3339 date")
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	if v := c.Query("min_amount"); v != "" {
+		amount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("min_amount must be an amount in minor units")
+		}
+		query = query.Where("amount >= ?", amount)
+	}
+	if v := c.Query("max_amount"); v != "" {
+		amount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("max_amount must be an amount in minor units")
+		}
+		query = query.Where("amount <= ?", amount)
+	}
+
+	if v := c.Query("type"); v != "" {
+		query = query.Where("type = ?", strings.ToUpper(v))
+	}
+	if v := c.Query("status"); v != "" {
+		query = query.Where("status = ?", strings.ToUpper(v))
+	}
+
+	switch strings.ToLower(c.Query("direction")) {
+	case "":
+	case "in":
+		query = query.Where("to_account_id = ?", accountID)
+	case "out":
+		query = query.Where("from_account_id = ?", accountID)
+	default:
+		return nil, errors.New("direction must be in or out")
+	}
+
+	if v := c.Query("counterparty_account_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("counterparty_account_id must be an account ID")
+		}
+		query = query.Where("(from_account_id = ? AND (to_account_id = ? OR attempted_to_account_id = ?)) OR (to_account_id = ? AND from_account_id = ?)",
+			accountID, id, id, accountID, id)
+	}
+	if v := c.Query("counterparty"); v != "" {
+		pattern := "%" + util.EscapeLike(v) + "%"
+		query = query.Where("counterparty_name ILIKE ? OR counterparty_account ILIKE ?", pattern, pattern)
+	}
+
+	if q := c.Query("q"); q != "" {
+		query = query.Where("description ILIKE ?", "%"+util.EscapeLike(q)+"%")
+	}
+
+	return query, nil
+}
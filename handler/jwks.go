@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/gofiber/fiber/v2"
+)
+
+// JWKS publishes the public keys access tokens can be verified with, so other
+// services can check tokens without sharing a secret
+func JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age="+strconv.Itoa(int(auth.JWKSMaxAge.Seconds())))
+	return c.JSON(fiber.Map{"keys": auth.JWKS()})
+}
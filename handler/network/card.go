@@ -0,0 +1,178 @@
+package network
+
+import (
+	"errors"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/cards"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Authorize decides a merchant's request to charge a card and holds the funds when approved
+func Authorize(c *fiber.Ctx) error {
+	type AuthorizationInput struct {
+		CardNumber   string         `json:"card_number"`
+		Expiry       string         `json:"expiry"` // MM/YY
+		CVV          string         `json:"cvv"`
+		Amount       money.Amount   `json:"amount"` // in minor units of currency
+		Currency     model.Currency `json:"currency"`
+		MerchantName string         `json:"merchant_name"`
+		MCC          string         `json:"mcc"`
+	}
+
+	input := new(AuthorizationInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid input",
+			"data":    nil,
+		})
+	}
+
+	if len(input.MerchantName) > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Merchant name must be at most 100 characters",
+			"data":    nil,
+		})
+	}
+
+	auth, err := cards.Authorize(database.DB, cards.AuthorizationRequest{
+		CardNumber:   input.CardNumber,
+		Expiry:       input.Expiry,
+		CVV:          input.CVV,
+		Amount:       input.Amount,
+		Currency:     input.Currency,
+		MerchantName: input.MerchantName,
+		MCC:          input.MCC,
+	})
+	if err != nil {
+		return networkError(c, err, "Could not authorize card payment")
+	}
+
+	if auth.Status == model.AUTH_DECLINED {
+		audit.Log(c, audit.Event{Action: audit.ActionCardDeclined, TargetType: "card_authorization", TargetID: auth.ID, After: auth})
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Authorization declined",
+			"data":    auth,
+		})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionCardAuthorized, TargetType: "card_authorization", TargetID: auth.ID, After: auth})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Authorization approved",
+		"data":    auth,
+	})
+}
+
+// Capture settles an approved authorization, in full unless a smaller amount is given
+func Capture(c *fiber.Ctx) error {
+	type CaptureInput struct {
+		Amount money.Amount `json:"amount"` // in minor units of the authorization currency, omit to capture in full
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid authorization ID",
+			"data":    nil,
+		})
+	}
+
+	input := new(CaptureInput)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid input",
+				"data":    nil,
+			})
+		}
+	}
+
+	auth, transaction, err := cards.Capture(database.DB, cards.CaptureRequest{
+		AuthorizationID: uint(id),
+		Amount:          input.Amount,
+	})
+	if err != nil {
+		return networkError(c, err, "Could not capture card payment")
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionCardCaptured, TargetType: "transaction", TargetID: transaction.ID, After: auth})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Card payment captured successfully",
+		"data": fiber.Map{
+			"authorization": auth,
+			"transaction":   transaction,
+		},
+	})
+}
+
+// Release cancels an approved authorization and frees the held funds
+func Release(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid authorization ID",
+			"data":    nil,
+		})
+	}
+
+	auth, err := cards.Release(database.DB, uint(id), "authorization released")
+	if err != nil {
+		return networkError(c, err, "Could not release authorization")
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionCardReleased, TargetType: "card_authorization", TargetID: auth.ID, After: auth})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Authorization released successfully",
+		"data":    auth,
+	})
+}
+
+// networkError maps card payment errors to HTTP responses
+func networkError(c *fiber.Ctx, err error, fallback string) error {
+	status, message := fiber.StatusInternalServerError, fallback
+
+	switch {
+	case errors.Is(err, cards.ErrUnknownCard):
+		status, message = fiber.StatusNotFound, "Card number not recognised"
+	case errors.Is(err, cards.ErrInvalidAmount):
+		status, message = fiber.StatusBadRequest, "Amount must be positive"
+	case errors.Is(err, cards.ErrUnsupportedCurrency):
+		status, message = fiber.StatusBadRequest, "Unsupported currency"
+	case errors.Is(err, cards.ErrMerchantRequired):
+		status, message = fiber.StatusBadRequest, "Merchant name is required"
+	case errors.Is(err, cards.ErrInvalidMCC):
+		status, message = fiber.StatusBadRequest, "Merchant category code must be four digits"
+	case errors.Is(err, cards.ErrAuthorizationNotFound):
+		status, message = fiber.StatusNotFound, "Authorization not found"
+	case errors.Is(err, cards.ErrAuthorizationNotOpen), errors.Is(err, holds.ErrHoldNotActive):
+		status, message = fiber.StatusConflict, "Authorization was already captured, released, expired or declined"
+	case errors.Is(err, cards.ErrAuthorizationExpired):
+		status, message = fiber.StatusConflict, "Authorization hold has expired"
+	case errors.Is(err, cards.ErrCaptureExceedsHold):
+		status, message = fiber.StatusBadRequest, "Capture amount exceeds the authorized amount"
+	case errors.Is(err, cards.ErrAccountInactive):
+		status, message = fiber.StatusConflict, "Bank account is closed"
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+		"data":    nil,
+	})
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/mailer"
+	"github.com/denver-code/moza-backend/util"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// appURL is the base URL of the client app used in emailed links
+func appURL() string {
+	if url := config.Config("APP_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// ForgotPassword emails a password reset link. The response is the same whether
+// or not the email is registered so it cannot be used to discover accounts.
+func ForgotPassword(c *fiber.Ctx) error {
+	type ForgotInput struct {
+		Email string `json:"email"`
+	}
+	input := new(ForgotInput)
+	if err := c.BodyParser(input); err != nil || !isEmail(input.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid email format", "data": nil})
+	}
+
+	response := fiber.Map{"status": "success", "message": "If the email is registered, a reset link has been sent", "data": nil}
+
+	user, err := getUserByEmail(input.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": nil})
+	}
+	if user == nil {
+		return c.JSON(response)
+	}
+
+	token, err := auth.IssueUserToken(database.DB, user.ID, model.PASSWORD_RESET, user.Email, auth.PasswordResetTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't create reset token", "data": nil})
+	}
+
+	if err := mailer.Mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Moza password",
+		Body: "Someone asked to reset the password of your Moza account.\n\n" +
+			"Reset it here within the next hour: " + appURL() + "/reset-password?token=" + token + "\n\n" +
+			"If it wasn't you, you can ignore this email.",
+	}); err != nil {
+		log.Printf("could not send password reset email to user %d: %v", user.ID, err)
+	}
+
+	return c.JSON(response)
+}
+
+// ResetPassword sets a new password using an emailed reset token and signs out every session
+func ResetPassword(c *fiber.Ctx) error {
+	type ResetInput struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	input := new(ResetInput)
+	if err := c.BodyParser(input); err != nil || input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid input", "data": nil})
+	}
+
+	if err := validatePassword(input.Password); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	hash, err := util.HashPassword(input.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't hash password", "data": nil})
+	}
+
+	var userID uint
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := auth.ConsumeUserToken(tx, input.Token, model.PASSWORD_RESET)
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+
+		var user model.User
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]any{"password": hash}
+		// Following the link proves the user owns the address it was sent to
+		if token.Email == user.Email && !user.EmailVerified {
+			updates["email_verified"] = true
+			updates["email_verified_at"] = token.CreatedAt
+		}
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidUserToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid or expired token", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't reset password", "data": nil})
+	}
+
+	if err := auth.RevokeAllForUser(database.DB, userID); err != nil {
+		log.Printf("could not revoke sessions of user %d after password reset: %v", userID, err)
+	}
+	// A reset proves ownership of the account, so it also lifts a login lockout
+	if err := auth.ResetLogin(database.DB, auth.UserThrottleKey(userID)); err != nil {
+		log.Printf("could not unlock user %d after password reset: %v", userID, err)
+	}
+
+	audit.Log(c, audit.Event{ActorID: &userID, Action: audit.ActionPasswordReset, TargetType: "user", TargetID: userID})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Password reset successfully, please log in again", "data": nil})
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GetSessions lists the active sessions of the user
+func GetSessions(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+	currentID, _ := claims["sid"].(float64)
+
+	sessions, err := auth.ActiveSessions(database.DB, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't retrieve sessions", "data": nil})
+	}
+
+	type SessionData struct {
+		model.Session
+		Current bool `json:"current"`
+	}
+	data := make([]SessionData, 0, len(sessions))
+	for _, s := range sessions {
+		data = append(data, SessionData{Session: s, Current: s.ID == uint(currentID)})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Sessions retrieved successfully", "data": data})
+}
+
+// RevokeSession terminates one of the user's sessions
+func RevokeSession(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	var session model.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&session).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "Session not found", "data": nil})
+	}
+
+	if err := auth.RevokeSession(database.DB, session.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't revoke session", "data": nil})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionSessionRevoked, TargetType: "session", TargetID: session.ID, Before: session})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Session revoked", "data": nil})
+}
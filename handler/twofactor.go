@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// currentUser loads the user of the access token
+func currentUser(c *fiber.Ctx) (*model.User, error) {
+	token := c.Locals("user").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userID := uint(claims["user_id"].(float64))
+
+	var user model.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetupTwoFactor generates a TOTP secret for the user to add to an authenticator app
+func SetupTwoFactor(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+
+	secret, uri, err := auth.SetupTOTP(database.DB, user)
+	if err != nil {
+		if errors.Is(err, auth.ErrTOTPAlreadyEnabled) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Two-factor authentication is already enabled", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't set up two-factor authentication", "data": nil})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Scan the URI with an authenticator app and confirm with a code", "data": fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": uri,
+	}})
+}
+
+// ConfirmTwoFactor enables two-factor authentication and returns the recovery codes once
+func ConfirmTwoFactor(c *fiber.Ctx) error {
+	type ConfirmInput struct {
+		Code string `json:"code"`
+	}
+	input := new(ConfirmInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid input", "data": nil})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+
+	codes, err := auth.ConfirmTOTP(database.DB, user, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrTOTPAlreadyEnabled):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Two-factor authentication is already enabled", "data": nil})
+		case errors.Is(err, auth.ErrTOTPNotEnrolled):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Two-factor authentication is not set up", "data": nil})
+		case errors.Is(err, auth.ErrInvalidCode):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid two-factor code", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't enable two-factor authentication", "data": nil})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionTwoFactorEnabled, TargetType: "user", TargetID: user.ID})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Two-factor authentication enabled, store the recovery codes safely", "data": fiber.Map{
+		"recovery_codes": codes,
+	}})
+}
+
+// DisableTwoFactor turns two-factor authentication off, requiring the password and a code
+func DisableTwoFactor(c *fiber.Ctx) error {
+	type DisableInput struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	input := new(DisableInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid input", "data": nil})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+
+	if ok, err := checkPassword(c, user, input.Password, "Invalid password"); !ok {
+		return err
+	}
+
+	if err := auth.VerifySecondFactor(database.DB, user.ID, input.Code); err != nil {
+		var throttle *auth.ThrottleError
+		if errors.As(err, &throttle) {
+			return loginThrottled(c, err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid two-factor code", "data": nil})
+	}
+
+	if err := auth.DisableTOTP(database.DB, user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't disable two-factor authentication", "data": nil})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionTwoFactorDisabled, TargetType: "user", TargetID: user.ID})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Two-factor authentication disabled", "data": nil})
+}
@@ -1,8 +1,15 @@
 package handler
 
 import (
+	"log"
+	"strings"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/auth"
 	"github.com/denver-code/moza-backend/database"
 	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/mailer"
+	"github.com/denver-code/moza-backend/util"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -23,3 +30,169 @@ func GetProfile(c *fiber.Ctx) error {
 	user.Password = ""
 	return c.JSON(fiber.Map{"status": "success", "message": "Profile retrieved successfully", "data": user})
 }
+
+// UpdateProfile changes the user's full name and username
+func UpdateProfile(c *fiber.Ctx) error {
+	type ProfileInput struct {
+		Username *string `json:"username"`
+		FullName *string `json:"full_name"`
+	}
+	input := new(ProfileInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid input", "data": nil})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+
+	updates := map[string]any{}
+	if input.FullName != nil {
+		fullName := strings.TrimSpace(*input.FullName)
+		if len(fullName) > 100 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Full name must be at most 100 characters", "data": nil})
+		}
+		updates["full_name"] = fullName
+	}
+
+	if input.Username != nil && *input.Username != user.Username {
+		if err := validateUsername(*input.Username); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+		}
+		if existingUser, err := getUserByUsername(*input.Username); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Error checking username", "data": nil})
+		} else if existingUser != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Username already taken", "data": nil})
+		}
+		updates["username"] = *input.Username
+	}
+
+	if len(updates) > 0 {
+		before := *user
+		if err := database.DB.Model(user).Updates(updates).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't update profile", "data": nil})
+		}
+		audit.Log(c, audit.Event{Action: audit.ActionProfileUpdated, TargetType: "user", TargetID: user.ID, Before: before, After: user})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Profile updated successfully", "data": user})
+}
+
+// checkPassword confirms the user's password for a sensitive change. Wrong passwords
+// count towards the login throttle so a stolen token cannot be used to guess it.
+// When it returns false the response is already written.
+func checkPassword(c *fiber.Ctx, user *model.User, password, message string) (bool, error) {
+	throttleKey := auth.UserThrottleKey(user.ID)
+	if err := auth.CheckLogin(database.DB, throttleKey, auth.IPThrottleKey(c.IP())); err != nil {
+		return false, loginThrottled(c, err)
+	}
+
+	if !util.CheckPasswordHash(password, user.Password) {
+		if err := auth.RecordLoginFailure(database.DB, throttleKey, &user.ID, c.IP()); err != nil {
+			log.Printf("could not record failed password check: %v", err)
+		}
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": message, "data": nil})
+	}
+	return true, nil
+}
+
+// ChangePassword replaces the password after checking the current one and signs out other sessions
+func ChangePassword(c *fiber.Ctx) error {
+	type PasswordInput struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	input := new(PasswordInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid input", "data": nil})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+
+	if ok, err := checkPassword(c, user, input.CurrentPassword, "Current password is incorrect"); !ok {
+		return err
+	}
+
+	if err := validatePassword(input.NewPassword); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+	if input.NewPassword == input.CurrentPassword {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "New password must be different from the current one", "data": nil})
+	}
+
+	hash, err := util.HashPassword(input.NewPassword)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't hash password", "data": nil})
+	}
+
+	if err := database.DB.Model(user).Update("password", hash).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't change password", "data": nil})
+	}
+
+	// Keep the session that changed the password, end all others
+	token := c.Locals("user").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	sid, _ := claims["sid"].(float64)
+	if err := auth.RevokeOtherSessions(database.DB, user.ID, uint(sid)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Password changed but other sessions couldn't be signed out", "data": nil})
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionPasswordChanged, TargetType: "user", TargetID: user.ID})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Password changed successfully", "data": nil})
+}
+
+// ChangeEmail sends a verification link to the new address, the email changes once it is verified
+func ChangeEmail(c *fiber.Ctx) error {
+	type EmailInput struct {
+		NewEmail string `json:"new_email"`
+		Password string `json:"password"`
+	}
+	input := new(EmailInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid input", "data": nil})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+
+	if ok, err := checkPassword(c, user, input.Password, "Invalid password"); !ok {
+		return err
+	}
+
+	if !isEmail(input.NewEmail) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid email format", "data": nil})
+	}
+	if input.NewEmail == user.Email {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "New email is the same as the current one", "data": nil})
+	}
+
+	if existingUser, err := getUserByEmail(input.NewEmail); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Error checking email", "data": nil})
+	} else if existingUser != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Email already registered", "data": nil})
+	}
+
+	if err := sendVerificationEmail(user, input.NewEmail); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't send verification email", "data": nil})
+	}
+
+	// Warn the current address in case the account was taken over
+	if err := mailer.Mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Moza email address is being changed",
+		Body:    "A request was made to change the email of your Moza account to " + input.NewEmail + ".\n\nIf it wasn't you, reset your password now.",
+	}); err != nil {
+		log.Printf("could not notify user %d of email change: %v", user.ID, err)
+	}
+
+	audit.Log(c, audit.Event{Action: audit.ActionEmailChangeRequested, TargetType: "user", TargetID: user.ID, Before: fiber.Map{"email": user.Email}, After: fiber.Map{"email": input.NewEmail}})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Verification email sent to the new address", "data": nil})
+}
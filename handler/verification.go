@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/denver-code/moza-backend/audit"
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/mailer"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var errEmailTaken = errors.New("email already registered")
+
+// sendVerificationEmail emails a link confirming that the user owns the address
+func sendVerificationEmail(user *model.User, email string) error {
+	token, err := auth.IssueUserToken(database.DB, user.ID, model.EMAIL_VERIFICATION, email, auth.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Mail.Send(mailer.Message{
+		To:      email,
+		Subject: "Verify your Moza email address",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"Please confirm your email address: " + appURL() + "/verify-email?token=" + token,
+	})
+}
+
+// VerifyEmail marks the address a verification token was sent to as verified
+func VerifyEmail(c *fiber.Ctx) error {
+	type VerifyInput struct {
+		Token string `json:"token"`
+	}
+	input := new(VerifyInput)
+	if err := c.BodyParser(input); err != nil || input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid input", "data": nil})
+	}
+
+	var before, after model.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := auth.ConsumeUserToken(tx, input.Token, model.EMAIL_VERIFICATION)
+		if err != nil {
+			return err
+		}
+
+		// The address may have been registered by someone else since the link was sent
+		var count int64
+		if err := tx.Model(&model.User{}).Where("email = ? AND id <> ?", token.Email, token.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errEmailTaken
+		}
+
+		if err := tx.First(&before, token.UserID).Error; err != nil {
+			return err
+		}
+		after = before
+		return tx.Model(&after).Updates(map[string]any{
+			"email":             token.Email,
+			"email_verified":    true,
+			"email_verified_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidUserToken):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid or expired token", "data": nil})
+		case errors.Is(err, errEmailTaken):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Email already registered", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't verify email", "data": nil})
+	}
+
+	audit.Log(c, audit.Event{ActorID: &after.ID, ActorRole: after.Role, Action: audit.ActionEmailVerified, TargetType: "user", TargetID: after.ID, Before: before, After: after})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Email verified successfully", "data": nil})
+}
+
+// ResendVerification sends a new verification link to the user's email
+func ResendVerification(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+
+	if user.EmailVerified {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Email already verified", "data": nil})
+	}
+
+	if err := sendVerificationEmail(user, user.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't send verification email", "data": nil})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Verification email sent", "data": nil})
+}
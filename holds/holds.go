@@ -0,0 +1,319 @@
+package holds
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const DefaultInterval = time.Minute
+
+var (
+	ErrInvalidAmount     = errors.New("hold amount must be positive")
+	ErrInvalidExpiry     = errors.New("hold must expire in the future")
+	ErrHoldNotFound      = errors.New("hold not found")
+	ErrHoldNotActive     = errors.New("hold was already captured, released or expired")
+	ErrInsufficientFunds = ledger.ErrInsufficientFunds
+
+	ErrDescriptionRequired = errors.New("a description is required")
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrAccountClosed       = errors.New("account is closed")
+	ErrNotManual           = errors.New("only holds placed by staff can be released")
+)
+
+// Expirer finishes whatever a hold of one kind was placed for once the hold expires,
+// for example by reversing its AUTHORISED transaction
+type Expirer func(tx *gorm.DB, hold *model.Hold) error
+
+var expirers = map[model.HoldKind]Expirer{}
+
+// OnExpire registers what to do when holds of a kind expire. It must be called before Start.
+func OnExpire(kind model.HoldKind, expire Expirer) {
+	expirers[kind] = expire
+}
+
+// Held returns the total of the active holds on an account that have not expired
+func Held(db *gorm.DB, accountID uint) (money.Amount, error) {
+	var held money.Amount
+	err := db.Model(&model.Hold{}).
+		Where("bank_account_id = ? AND status = ? AND expires_at > ?", accountID, model.HOLD_ACTIVE, time.Now()).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&held).Error
+	return held, err
+}
+
+// Available returns the ledger balance of an account less the funds on hold
+func Available(db *gorm.DB, account *model.BankAccount) (money.Amount, error) {
+	held, err := Held(db, account.ID)
+	if err != nil {
+		return 0, err
+	}
+	return account.Balance - held, nil
+}
+
+// FillAvailable sets the available balance of accounts about to be returned to a client
+func FillAvailable(db *gorm.DB, accounts []model.BankAccount) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(accounts))
+	for i, account := range accounts {
+		ids[i] = account.ID
+	}
+
+	var rows []struct {
+		BankAccountID uint
+		Held          money.Amount
+	}
+	if err := db.Model(&model.Hold{}).
+		Where("bank_account_id IN ? AND status = ? AND expires_at > ?", ids, model.HOLD_ACTIVE, time.Now()).
+		Select("bank_account_id, SUM(amount) AS held").
+		Group("bank_account_id").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	held := make(map[uint]money.Amount, len(rows))
+	for _, row := range rows {
+		held[row.BankAccountID] = row.Held
+	}
+	for i := range accounts {
+		accounts[i].AvailableBalance = accounts[i].Balance - held[accounts[i].ID]
+	}
+	return nil
+}
+
+// Request describes funds to put on hold
+type Request struct {
+	Kind          model.HoldKind
+	Amount        money.Amount // in minor units of the account currency
+	Description   string
+	ExpiresAt     time.Time
+	TransactionID *uint
+	PlacedByID    *uint
+}
+
+// Place puts funds on hold. The account must have been locked by the caller so the
+// available balance cannot change before the hold is stored.
+func Place(tx *gorm.DB, account *model.BankAccount, req Request) (*model.Hold, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	available, err := Available(tx, account)
+	if err != nil {
+		return nil, err
+	}
+	if available < req.Amount {
+		return nil, ErrInsufficientFunds
+	}
+
+	hold := &model.Hold{
+		BankAccountID: account.ID,
+		Kind:          req.Kind,
+		Status:        model.HOLD_ACTIVE,
+		Amount:        req.Amount,
+		Currency:      account.Currency,
+		Description:   strings.TrimSpace(req.Description),
+		ExpiresAt:     req.ExpiresAt,
+		TransactionID: req.TransactionID,
+		PlacedByID:    req.PlacedByID,
+	}
+	if err := tx.Create(hold).Error; err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// Lock loads an active hold with SELECT ... FOR UPDATE. Lock its account first,
+// every path that finishes a hold does so in the same order.
+func Lock(tx *gorm.DB, id uint) (*model.Hold, error) {
+	var hold model.Hold
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&hold, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, err
+	}
+	if hold.Status != model.HOLD_ACTIVE {
+		return nil, ErrHoldNotActive
+	}
+	return &hold, nil
+}
+
+// Finish moves a locked active hold to its final status, which frees the funds
+func Finish(tx *gorm.DB, hold *model.Hold, status model.HoldStatus) error {
+	now := time.Now()
+	result := tx.Model(&model.Hold{}).
+		Where("id = ? AND status = ?", hold.ID, model.HOLD_ACTIVE).
+		Updates(map[string]any{"status": status, "released_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrHoldNotActive
+	}
+
+	hold.Status = status
+	hold.ReleasedAt = &now
+	return nil
+}
+
+// Start releases expired holds every interval until the process exits
+func Start(db *gorm.DB) {
+	interval := DefaultInterval
+	if d, err := time.ParseDuration(config.Config("HOLD_EXPIRY_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if n, err := ExpireDue(db, now); err != nil {
+			log.Printf("holds: %v", err)
+		} else if n > 0 {
+			log.Printf("holds: released %d expired holds", n)
+		}
+	}
+}
+
+// ExpireDue releases every active hold whose expiry time has passed
+func ExpireDue(db *gorm.DB, now time.Time) (int, error) {
+	var due []model.Hold
+	if err := db.Select("id", "bank_account_id").
+		Where("status = ? AND expires_at <= ?", model.HOLD_ACTIVE, now).
+		Order("expires_at").
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, hold := range due {
+		ok, err := expireOne(db, hold.ID, hold.BankAccountID, now)
+		if err != nil {
+			log.Printf("holds: hold %d: %v", hold.ID, err)
+			continue
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// expireOne releases a single expired hold and runs the expirer of its kind.
+// Holds finished concurrently are skipped.
+func expireOne(db *gorm.DB, id, accountID uint, now time.Time) (bool, error) {
+	ok := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := ledger.LockAccounts(tx, accountID); err != nil {
+			return err
+		}
+
+		var hold model.Hold
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ? AND expires_at <= ?", id, model.HOLD_ACTIVE, now).
+			First(&hold).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if expire, found := expirers[hold.Kind]; found {
+			if err := expire(tx, &hold); err != nil {
+				return err
+			}
+		}
+		ok = true
+		return Finish(tx, &hold, model.HOLD_EXPIRED)
+	})
+	return ok, err
+}
+
+// ManualRequest describes a hold placed by staff
+type ManualRequest struct {
+	StaffID     uint
+	AccountID   uint
+	Amount      money.Amount // in minor units of the account currency
+	Description string
+	ExpiresAt   time.Time
+}
+
+// PlaceManual lets staff hold funds on any account that is not closed
+func PlaceManual(db *gorm.DB, req ManualRequest) (*model.Hold, error) {
+	if strings.TrimSpace(req.Description) == "" {
+		return nil, ErrDescriptionRequired
+	}
+
+	var hold *model.Hold
+	err := db.Transaction(func(tx *gorm.DB) error {
+		accounts, err := ledger.LockAccounts(tx, req.AccountID)
+		if err != nil {
+			return err
+		}
+		account, ok := accounts[req.AccountID]
+		if !ok {
+			return ErrAccountNotFound
+		}
+		if account.Status == model.ACCOUNT_CLOSED {
+			return ErrAccountClosed
+		}
+
+		hold, err = Place(tx, account, Request{
+			Kind:        model.HOLD_MANUAL,
+			Amount:      req.Amount,
+			Description: req.Description,
+			ExpiresAt:   req.ExpiresAt,
+			PlacedByID:  &req.StaffID,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ReleaseManual frees a hold placed by staff. Card holds are finished by the
+// card network instead.
+func ReleaseManual(db *gorm.DB, id uint) (*model.Hold, error) {
+	var found model.Hold
+	if err := db.First(&found, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, err
+	}
+	if found.Kind != model.HOLD_MANUAL {
+		return nil, ErrNotManual
+	}
+
+	var hold *model.Hold
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := ledger.LockAccounts(tx, found.BankAccountID); err != nil {
+			return err
+		}
+		var err error
+		if hold, err = Lock(tx, id); err != nil {
+			return err
+		}
+		return Finish(tx, hold, model.HOLD_RELEASED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
@@ -0,0 +1,262 @@
+package ledger
+
+import (
+	"errors"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTooFewPostings    = errors.New("journal entry needs at least two postings")
+	ErrInvalidPosting    = errors.New("posting must target exactly one account with a positive amount")
+	ErrUnbalanced        = errors.New("journal entry debits and credits do not balance")
+	ErrInsufficientFunds = errors.New("insufficient balance")
+)
+
+// signed returns the effect of a posting on a customer account or pot balance.
+// Customer accounts are liabilities of the bank, so credits increase them.
+func signed(p model.Posting) money.Amount {
+	if p.Direction == model.CREDIT {
+		return p.Amount
+	}
+	return -p.Amount
+}
+
+// Validate checks that the entry is well formed and balanced per currency
+func Validate(entry *model.JournalEntry) error {
+	if len(entry.Postings) < 2 {
+		return ErrTooFewPostings
+	}
+
+	totals := map[model.Currency]money.Amount{}
+	for _, p := range entry.Postings {
+		targets := 0
+		for _, set := range []bool{p.BankAccountID != nil, p.PotID != nil, p.SystemAccount != ""} {
+			if set {
+				targets++
+			}
+		}
+		if targets != 1 || p.Amount <= 0 || !p.Currency.Valid() {
+			return ErrInvalidPosting
+		}
+		if p.Direction != model.DEBIT && p.Direction != model.CREDIT {
+			return ErrInvalidPosting
+		}
+		totals[p.Currency] += signed(p)
+	}
+
+	for _, total := range totals {
+		if total != 0 {
+			return ErrUnbalanced
+		}
+	}
+	return nil
+}
+
+// Post writes a balanced journal entry and applies it to the cached account balances.
+// It must be called inside a database transaction.
+func Post(tx *gorm.DB, entry *model.JournalEntry) error {
+	if err := Validate(entry); err != nil {
+		return err
+	}
+
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+
+	for _, p := range entry.Postings {
+		var target any
+		var id uint
+		switch {
+		case p.BankAccountID != nil:
+			target, id = &model.BankAccount{}, *p.BankAccountID
+		case p.PotID != nil:
+			target, id = &model.Pot{}, *p.PotID
+		default:
+			continue
+		}
+
+		// The balance guard is a last line of defence, callers should lock and check first
+		result := tx.Model(target).
+			Where("id = ? AND balance + ? >= 0", id, signed(p)).
+			Update("balance", gorm.Expr("balance + ?", signed(p)))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientFunds
+		}
+	}
+	return nil
+}
+
+// LockAccounts loads bank accounts with SELECT ... FOR UPDATE.
+// Rows are always locked in ascending ID order so concurrent movements
+// between the same accounts cannot deadlock.
+func LockAccounts(tx *gorm.DB, ids ...uint) (map[uint]*model.BankAccount, error) {
+	var accounts []model.BankAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+
+	locked := make(map[uint]*model.BankAccount, len(accounts))
+	for i := range accounts {
+		locked[accounts[i].ID] = &accounts[i]
+	}
+	return locked, nil
+}
+
+// Transfer builds an entry moving amount from one bank account to another
+func Transfer(fromID, toID uint, amount money.Amount, currency model.Currency, description string) *model.JournalEntry {
+	return &model.JournalEntry{
+		Description: description,
+		Postings: []model.Posting{
+			{BankAccountID: &fromID, Direction: model.DEBIT, Amount: amount, Currency: currency},
+			{BankAccountID: &toID, Direction: model.CREDIT, Amount: amount, Currency: currency},
+		},
+	}
+}
+
+// ExchangeTransfer builds an entry converting between accounts in different currencies.
+// Each currency balances against the FX position account.
+func ExchangeTransfer(fromID, toID uint, fromAmount money.Amount, fromCurrency model.Currency, toAmount money.Amount, toCurrency model.Currency, description string) *model.JournalEntry {
+	return &model.JournalEntry{
+		Description: description,
+		Postings: []model.Posting{
+			{BankAccountID: &fromID, Direction: model.DEBIT, Amount: fromAmount, Currency: fromCurrency},
+			{SystemAccount: model.FXPosition, Direction: model.CREDIT, Amount: fromAmount, Currency: fromCurrency},
+			{SystemAccount: model.FXPosition, Direction: model.DEBIT, Amount: toAmount, Currency: toCurrency},
+			{BankAccountID: &toID, Direction: model.CREDIT, Amount: toAmount, Currency: toCurrency},
+		},
+	}
+}
+
+// Deposit builds an entry crediting an account with money from outside the bank
+func Deposit(accountID uint, amount money.Amount, currency model.Currency, description string) *model.JournalEntry {
+	return &model.JournalEntry{
+		Description: description,
+		Postings: []model.Posting{
+			{SystemAccount: model.ExternalClearing, Direction: model.DEBIT, Amount: amount, Currency: currency},
+			{BankAccountID: &accountID, Direction: model.CREDIT, Amount: amount, Currency: currency},
+		},
+	}
+}
+
+// Withdrawal builds an entry debiting an account for money leaving the bank
+func Withdrawal(accountID uint, amount money.Amount, currency model.Currency, description string) *model.JournalEntry {
+	return &model.JournalEntry{
+		Description: description,
+		Postings: []model.Posting{
+			{BankAccountID: &accountID, Direction: model.DEBIT, Amount: amount, Currency: currency},
+			{SystemAccount: model.ExternalClearing, Direction: model.CREDIT, Amount: amount, Currency: currency},
+		},
+	}
+}
+
+// CardPayment builds an entry debiting an account for a captured card payment
+func CardPayment(accountID uint, amount money.Amount, currency model.Currency, description string) *model.JournalEntry {
+	return &model.JournalEntry{
+		Description: description,
+		Postings: []model.Posting{
+			{BankAccountID: &accountID, Direction: model.DEBIT, Amount: amount, Currency: currency},
+			{SystemAccount: model.CardSettlement, Direction: model.CREDIT, Amount: amount, Currency: currency},
+		},
+	}
+}
+
+// Adjustment builds an entry correcting an account balance by a signed amount,
+// positive amounts credit the account and negative amounts debit it
+func Adjustment(accountID uint, amount money.Amount, currency model.Currency, description string) *model.JournalEntry {
+	account, system := model.CREDIT, model.DEBIT
+	if amount < 0 {
+		account, system, amount = model.DEBIT, model.CREDIT, -amount
+	}
+	return &model.JournalEntry{
+		Description: description,
+		Postings: []model.Posting{
+			{SystemAccount: model.Adjustments, Direction: system, Amount: amount, Currency: currency},
+			{BankAccountID: &accountID, Direction: account, Amount: amount, Currency: currency},
+		},
+	}
+}
+
+// OpeningBalance builds an entry backing a balance an account held before the
+// ledger existed. It is written without Post, the cached balance already includes it.
+func OpeningBalance(accountID uint, balance money.Amount, currency model.Currency) *model.JournalEntry {
+	entry := Adjustment(accountID, balance, currency, "Opening balance")
+	for i := range entry.Postings {
+		if entry.Postings[i].SystemAccount != "" {
+			entry.Postings[i].SystemAccount = model.OpeningBalances
+		}
+	}
+	return entry
+}
+
+// PotDeposit builds an entry moving money from an account into one of its pots
+func PotDeposit(accountID, potID uint, amount money.Amount, currency model.Currency, description string) *model.JournalEntry {
+	return &model.JournalEntry{
+		Description: description,
+		Postings: []model.Posting{
+			{BankAccountID: &accountID, Direction: model.DEBIT, Amount: amount, Currency: currency},
+			{PotID: &potID, Direction: model.CREDIT, Amount: amount, Currency: currency},
+		},
+	}
+}
+
+// PotWithdrawal builds an entry moving money from a pot back into its account
+func PotWithdrawal(accountID, potID uint, amount money.Amount, currency model.Currency, description string) *model.JournalEntry {
+	return &model.JournalEntry{
+		Description: description,
+		Postings: []model.Posting{
+			{PotID: &potID, Direction: model.DEBIT, Amount: amount, Currency: currency},
+			{BankAccountID: &accountID, Direction: model.CREDIT, Amount: amount, Currency: currency},
+		},
+	}
+}
+
+// Reverse builds an entry that undoes the given entry by swapping every posting side
+func Reverse(entry *model.JournalEntry, description string) *model.JournalEntry {
+	reversal := &model.JournalEntry{Description: description}
+	for _, p := range entry.Postings {
+		direction := model.CREDIT
+		if p.Direction == model.CREDIT {
+			direction = model.DEBIT
+		}
+		reversal.Postings = append(reversal.Postings, model.Posting{
+			BankAccountID: p.BankAccountID,
+			PotID:         p.PotID,
+			SystemAccount: p.SystemAccount,
+			Direction:     direction,
+			Amount:        p.Amount,
+			Currency:      p.Currency,
+		})
+	}
+	return reversal
+}
+
+// Balance derives an account balance from its postings
+func Balance(db *gorm.DB, accountID uint) (money.Amount, error) {
+	var balance money.Amount
+	err := db.Model(&model.Posting{}).
+		Select("COALESCE(SUM(CASE WHEN direction = ? THEN amount ELSE -amount END), 0)", model.CREDIT).
+		Where("bank_account_id = ?", accountID).
+		Scan(&balance).Error
+	return balance, err
+}
+
+// Recompute overwrites the cached balance of an account with its ledger balance
+func Recompute(db *gorm.DB, accountID uint) (money.Amount, error) {
+	balance, err := Balance(db, accountID)
+	if err != nil {
+		return 0, err
+	}
+	err = db.Model(&model.BankAccount{}).Where("id = ?", accountID).Update("balance", balance).Error
+	return balance, err
+}
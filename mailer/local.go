@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Console prints messages to stdout, for local development
+type Console struct{}
+
+// Send implements Mailer
+func (Console) Send(msg Message) error {
+	fmt.Print("----- email -----\n" + format(msg) + "-----------------\n")
+	return nil
+}
+
+// File appends messages to a file, for local development and tests
+type File struct {
+	Path string
+}
+
+var fileMu sync.Mutex
+
+// Send implements Mailer
+func (f File) Send(msg Message) error {
+	path := f.Path
+	if path == "" {
+		path = "mail.log"
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(format(msg) + "\n")
+	return err
+}
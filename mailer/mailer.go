@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/denver-code/moza-backend/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Mail is the mailer used by the application, set up by Setup
+var Mail Mailer = Console{}
+
+// Setup selects the mailer from the MAILER env value: smtp, file or console (default)
+func Setup() {
+	switch strings.ToLower(config.Config("MAILER")) {
+	case "smtp":
+		Mail = SMTP{
+			Host:     config.Config("SMTP_HOST"),
+			Port:     config.Config("SMTP_PORT"),
+			Username: config.Config("SMTP_USER"),
+			Password: config.Config("SMTP_PASSWORD"),
+			From:     config.Config("MAIL_FROM"),
+		}
+	case "file":
+		Mail = File{Path: config.Config("MAIL_FILE")}
+	default:
+		Mail = Console{}
+	}
+	log.Printf("Mailer: %T", Mail)
+}
+
+// format renders a message the way it is written to logs and files
+func format(msg Message) string {
+	return fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+}
@@ -3,8 +3,17 @@ package main
 import (
 	"log"
 
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/cards"
+	"github.com/denver-code/moza-backend/config"
 	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/encryption"
+	"github.com/denver-code/moza-backend/fx"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/denver-code/moza-backend/mailer"
 	"github.com/denver-code/moza-backend/router"
+	"github.com/denver-code/moza-backend/scheduler"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -14,7 +23,43 @@ func main() {
 	app := fiber.New()
 	app.Use(cors.New())
 
+	// Card details are encrypted while migrating, so keys are needed first
+	if err := encryption.Setup(); err != nil {
+		log.Fatalf("failed to set up encryption keys: %v", err)
+	}
+
 	database.ConnectDB()
+	mailer.Setup()
+
+	if err := database.PromoteAdmin(); err != nil {
+		log.Fatalf("failed to promote admin: %v", err)
+	}
+
+	if err := cards.SetupSchemes(); err != nil {
+		log.Fatalf("failed to set up card schemes: %v", err)
+	}
+
+	if err := auth.SetupKeys(database.DB); err != nil {
+		log.Fatalf("failed to set up signing keys: %v", err)
+	}
+	go auth.StartKeyRotation(database.DB)
+
+	if path := config.Config("FX_RATES_FILE"); path != "" {
+		n, err := fx.LoadFile(database.DB, path)
+		if err != nil {
+			log.Fatalf("failed to load exchange rates: %v", err)
+		}
+		if n > 0 {
+			log.Printf("Loaded %d exchange rates from %s", n, path)
+		}
+	}
+
+	// Run standing orders and future-dated payments in the background
+	go scheduler.Start(database.DB)
+
+	// Release funds held for card payments that were never captured
+	holds.OnExpire(model.HOLD_CARD_AUTHORIZATION, cards.ExpireAuthorization)
+	go holds.Start(database.DB)
 
 	router.SetupRoutes(app)
 	log.Fatal(app.Listen(":3000"))
@@ -1,20 +1,41 @@
 package middleware
 
 import (
-	"github.com/denver-code/moza-backend/config"
+	"errors"
+
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/database"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // Protected protect routes
 func Protected() fiber.Handler {
 	return jwtware.New(jwtware.Config{
-		SigningKey:   jwtware.SigningKey{Key: []byte(config.Config("SECRET"))},
-		ErrorHandler: jwtError,
+		KeyFunc:        auth.KeyFunc(database.DB),
+		SuccessHandler: checkRevocation,
+		ErrorHandler:   jwtError,
 	})
 }
 
+// checkRevocation rejects valid but revoked tokens
+func checkRevocation(c *fiber.Ctx) error {
+	token := c.Locals("user").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	if err := auth.CheckToken(database.DB, claims); err != nil {
+		if errors.Is(err, auth.ErrTokenRevoked) {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(fiber.Map{"status": "error", "message": "Token has been revoked", "data": nil})
+		}
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Couldn't verify token", "data": nil})
+	}
+	return c.Next()
+}
+
 func jwtError(c *fiber.Ctx, err error) error {
 	if err.Error() == "Missing or malformed JWT" {
 		return c.Status(fiber.StatusBadRequest).
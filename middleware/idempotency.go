@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyClaimTimeout is how long a request may run before a retry with the same key
+// takes its claim over, so a key whose request crashed does not stay in progress forever
+const IdempotencyClaimTimeout = 5 * time.Minute
+
+// Idempotency replays the stored response when a request is retried with the same
+// Idempotency-Key header. It must run after Protected, keys are scoped per user.
+func Idempotency() fiber.Handler {
+	return userIdempotency(false)
+}
+
+// RequireIdempotency is Idempotency for routes that refuse requests without a key
+func RequireIdempotency() fiber.Handler {
+	return userIdempotency(true)
+}
+
+func userIdempotency(required bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" && required {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "Idempotency-Key header is required", "data": nil})
+		}
+		if key == "" {
+			return c.Next()
+		}
+
+		token := c.Locals("user").(*jwt.Token)
+		claims := token.Claims.(jwt.MapClaims)
+		userID := uint(claims["user_id"].(float64))
+
+		return idempotent(c, userID, key)
+	}
+}
+
+// NetworkIdempotency is Idempotency for the card network routes, which have no user.
+// It must run after NetworkKey, keys are scoped per network key.
+func NetworkIdempotency() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" {
+			return c.Next()
+		}
+
+		// User IDs start at 1, the network's keys are stored under 0
+		network := sha256.Sum256([]byte(c.Get("X-Network-Key")))
+		return idempotent(c, 0, "network:"+hex.EncodeToString(network[:8])+":"+key)
+	}
+}
+
+// idempotent claims key for the owner, runs the handler and stores its response
+func idempotent(c *fiber.Ctx, userID uint, key string) error {
+	if len(c.Get("Idempotency-Key")) > 255 {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "Idempotency key is too long", "data": nil})
+	}
+
+	sum := sha256.Sum256([]byte(c.Method() + " " + c.Path() + "\n" + string(c.Body())))
+	hash := hex.EncodeToString(sum[:])
+
+	// Claim the key, only one request can insert it
+	record := model.IdempotencyKey{UserID: userID, Key: key, RequestHash: hash}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Could not store idempotency key", "data": nil})
+	}
+
+	if result.RowsAffected == 0 {
+		existing, err := claimed(c, userID, key, hash)
+		if existing == nil {
+			return err
+		}
+		record = *existing
+	}
+
+	if err := c.Next(); err != nil {
+		database.DB.Unscoped().Delete(&record)
+		return err
+	}
+
+	// Server errors and rejected credentials are not stored so the client can retry them
+	status := c.Response().StatusCode()
+	if status >= fiber.StatusInternalServerError || status == fiber.StatusUnauthorized || status == fiber.StatusForbidden {
+		database.DB.Unscoped().Delete(&record)
+		return nil
+	}
+
+	now := time.Now()
+	database.DB.Model(&record).Updates(model.IdempotencyKey{
+		StatusCode:  status,
+		Response:    c.Response().Body(),
+		CompletedAt: &now,
+	})
+	return nil
+}
+
+// claimed handles a key another request already claimed. It replays the stored
+// response, or returns the claim when it was abandoned and this request took it over.
+// When it returns no claim the response is already written.
+func claimed(c *fiber.Ctx, userID uint, key, hash string) (*model.IdempotencyKey, error) {
+	var existing model.IdempotencyKey
+	if err := database.DB.Where(&model.IdempotencyKey{UserID: userID, Key: key}).First(&existing).Error; err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Could not load idempotency key", "data": nil})
+	}
+
+	if existing.RequestHash != hash {
+		return nil, c.Status(fiber.StatusUnprocessableEntity).
+			JSON(fiber.Map{"status": "error", "message": "Idempotency key was already used for a different request", "data": nil})
+	}
+
+	if existing.CompletedAt == nil {
+		// Only one retry can move the claim time forward
+		now := time.Now()
+		result := database.DB.Model(&model.IdempotencyKey{}).
+			Where("id = ? AND completed_at IS NULL AND updated_at < ?", existing.ID, now.Add(-IdempotencyClaimTimeout)).
+			Update("updated_at", now)
+		if result.Error != nil {
+			return nil, c.Status(fiber.StatusInternalServerError).
+				JSON(fiber.Map{"status": "error", "message": "Could not store idempotency key", "data": nil})
+		}
+		if result.RowsAffected == 1 {
+			return &existing, nil
+		}
+		return nil, c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": "A request with this idempotency key is still in progress", "data": nil})
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return nil, c.Status(existing.StatusCode).Send(existing.Response)
+}
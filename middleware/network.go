@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/denver-code/moza-backend/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// NetworkKey protects the card network routes with the shared CARD_NETWORK_KEY
+func NetworkKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := config.Config("CARD_NETWORK_KEY")
+		provided := c.Get("X-Network-Key")
+		if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(provided)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(fiber.Map{"status": "error", "message": "Invalid network key", "data": nil})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/denver-code/moza-backend/database/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RequireRole only lets users with one of the given roles through, it must run after Protected
+func RequireRole(roles ...model.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Locals("user").(*jwt.Token)
+		claims := token.Claims.(jwt.MapClaims)
+		role, _ := claims["role"].(string)
+
+		if !slices.Contains(roles, model.Role(role)) {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Insufficient permissions", "data": nil})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/denver-code/moza-backend/auth"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// StepUp requires a fresh second factor in the X-2FA-Code header for sensitive
+// actions of users with two-factor authentication. When required is not nil the
+// check only applies to requests it returns true for. Repeated wrong codes lock the
+// second factor for a while, see auth.VerifySecondFactor. It must run after Protected.
+func StepUp(required func(*fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if required != nil && !required(c) {
+			return c.Next()
+		}
+
+		token := c.Locals("user").(*jwt.Token)
+		claims := token.Claims.(jwt.MapClaims)
+		userID := uint(claims["user_id"].(float64))
+
+		var user model.User
+		if err := database.DB.Select("id", "totp_enabled").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+		}
+		if !user.TOTPEnabled {
+			return c.Next()
+		}
+
+		code := c.Get("X-2FA-Code")
+		if code == "" {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Two-factor code required", "data": fiber.Map{"step_up_required": true}})
+		}
+
+		if err := auth.VerifySecondFactor(database.DB, userID, code); err != nil {
+			var throttle *auth.ThrottleError
+			if errors.As(err, &throttle) {
+				seconds := int(math.Ceil(throttle.RetryAfter.Seconds()))
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+				return c.Status(fiber.StatusTooManyRequests).
+					JSON(fiber.Map{"status": "error", "message": "Too many invalid two-factor codes, please retry later", "data": fiber.Map{"retry_after": seconds}})
+			}
+			if errors.Is(err, auth.ErrInvalidCode) {
+				return c.Status(fiber.StatusForbidden).
+					JSON(fiber.Map{"status": "error", "message": "Invalid two-factor code", "data": fiber.Map{"step_up_required": true}})
+			}
+			return c.Status(fiber.StatusInternalServerError).
+				JSON(fiber.Map{"status": "error", "message": "Couldn't verify two-factor code", "data": nil})
+		}
+		return c.Next()
+	}
+}
+
+// AboveStepUpThreshold reports whether the JSON body moves an amount at or above
+// the configured step-up threshold
+func AboveStepUpThreshold(c *fiber.Ctx) bool {
+	var body struct {
+		Amount int64 `json:"amount"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return true
+	}
+	return body.Amount >= auth.StepUpThreshold()
+}
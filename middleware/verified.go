@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database"
+	"github.com/denver-code/moza-backend/database/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerifiedEmail rejects users who have not verified their email address when
+// REQUIRE_EMAIL_VERIFICATION is enabled. It must run after Protected.
+func VerifiedEmail() fiber.Handler {
+	if !strings.EqualFold(config.Config("REQUIRE_EMAIL_VERIFICATION"), "true") {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		token := c.Locals("user").(*jwt.Token)
+		claims := token.Claims.(jwt.MapClaims)
+		userID := uint(claims["user_id"].(float64))
+
+		var user model.User
+		if err := database.DB.Select("id", "email_verified").First(&user, userID).Error; err != nil || !user.EmailVerified {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Email address not verified", "data": nil})
+		}
+		return c.Next()
+	}
+}
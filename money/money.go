@@ -0,0 +1,67 @@
+package money
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Currency is an ISO 4217 currency code
+type Currency string
+
+const (
+	USD Currency = "USD"
+	EUR Currency = "EUR"
+	GBP Currency = "GBP"
+)
+
+// exponents holds the number of minor unit digits of each supported currency
+var exponents = map[Currency]int{
+	USD: 2,
+	EUR: 2,
+	GBP: 2,
+}
+
+// Valid reports whether the currency is supported
+func (c Currency) Valid() bool {
+	_, ok := exponents[c]
+	return ok
+}
+
+// Exponent returns the number of minor unit digits of the currency
+func (c Currency) Exponent() int {
+	return exponents[c]
+}
+
+// Currencies returns the supported currencies in alphabetical order
+func Currencies() []Currency {
+	currencies := make([]Currency, 0, len(exponents))
+	for c := range exponents {
+		currencies = append(currencies, c)
+	}
+	slices.Sort(currencies)
+	return currencies
+}
+
+// Amount is a monetary value in integer minor units of its currency, e.g. pence for GBP.
+// It is always paired with a Currency by the struct that holds it. JSON carries the
+// integer as is, so an amount of 100 in GBP is 1.00 GBP.
+type Amount int64
+
+// format renders the amount as a decimal string with exp decimal places
+func (a Amount) format(exp int) string {
+	n := int64(a)
+	sign := ""
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%s%d", sign, n)
+	}
+
+	unit := int64(1)
+	for i := 0; i < exp; i++ {
+		unit *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, n/unit, exp, n%unit)
+}
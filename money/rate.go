@@ -0,0 +1,109 @@
+package money
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RateScale is the number of decimal places kept for exchange rates
+const RateScale = 8
+
+var rateUnit = big.NewInt(100000000)
+
+var (
+	ErrInvalidRate    = errors.New("invalid exchange rate")
+	ErrAmountOverflow = errors.New("converted amount is too large")
+)
+
+// Rate is an exchange rate stored as a fixed-point integer with RateScale decimals.
+// A Rate of 116500000 between GBP and EUR means 1 GBP buys 1.165 EUR.
+type Rate int64
+
+// ParseRate reads a decimal string such as "1.165" into a Rate
+func ParseRate(s string) (Rate, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if whole == "" || len(frac) > RateScale || strings.ContainsAny(whole+frac, "+-") {
+		return 0, ErrInvalidRate
+	}
+	frac += strings.Repeat("0", RateScale-len(frac))
+
+	n, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, ErrInvalidRate
+	}
+	return Rate(n), nil
+}
+
+// String renders the rate as a decimal string
+func (r Rate) String() string {
+	return Amount(r).format(RateScale)
+}
+
+// Inverse returns the rate for the opposite currency pair, rounded down
+func (r Rate) Inverse() Rate {
+	if r <= 0 {
+		return 0
+	}
+	n := new(big.Int).Mul(rateUnit, rateUnit)
+	n.Quo(n, big.NewInt(int64(r)))
+	return Rate(n.Int64())
+}
+
+// WithSpread reduces the rate by a spread expressed in basis points
+func (r Rate) WithSpread(bps int) Rate {
+	n := big.NewInt(int64(r))
+	n.Mul(n, big.NewInt(int64(10000-bps)))
+	n.Quo(n, big.NewInt(10000))
+	return Rate(n.Int64())
+}
+
+// Convert exchanges an amount in currency from into currency to at this rate.
+// The result is rounded down to the nearest minor unit of the target currency,
+// results that do not fit an Amount return ErrAmountOverflow.
+func (r Rate) Convert(amount Amount, from, to Currency) (Amount, error) {
+	n := big.NewInt(int64(amount))
+	n.Mul(n, big.NewInt(int64(r)))
+
+	d := new(big.Int).Set(rateUnit)
+	shift := to.Exponent() - from.Exponent()
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil)
+	if shift >= 0 {
+		n.Mul(n, pow)
+	} else {
+		d.Mul(d, pow)
+	}
+
+	n.Quo(n, d)
+	if !n.IsInt64() {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(n.Int64()), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// MarshalJSON encodes the rate as a decimal string
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(r.String())), nil
+}
+
+// UnmarshalJSON decodes a rate from a decimal string
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return ErrInvalidRate
+	}
+	rate, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
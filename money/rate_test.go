@@ -0,0 +1,87 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Rate
+		err  bool
+	}{
+		{"1.165", 116500000, false},
+		{"1", 100000000, false},
+		{"0.00000001", 1, false},
+		{"0.000000001", 0, true},
+		{"0", 0, true},
+		{"-1.2", 0, true},
+		{"+1.2", 0, true},
+		{"abc", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestRateConvert(t *testing.T) {
+	// A currency without minor units, to check the exponent shift
+	exponents["JPY"] = 0
+	t.Cleanup(func() { delete(exponents, "JPY") })
+
+	tests := []struct {
+		rate     string
+		amount   Amount
+		from, to Currency
+		want     Amount
+	}{
+		{"1.165", 10000, GBP, EUR, 11650},
+		{"1.165", 1, GBP, EUR, 1},         // 1.165 pence rounds down
+		{"0.5", 1, GBP, EUR, 0},           // half a cent rounds down to nothing
+		{"190.25", 100, GBP, "JPY", 190},  // 1 GBP buys 190 yen
+		{"0.0052", 1000, "JPY", GBP, 520}, // 1000 yen buy 5.20 GBP
+	}
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := rate.Convert(tt.amount, tt.from, tt.to)
+		if err != nil || got != tt.want {
+			t.Errorf("%s.Convert(%d %s to %s) = %d, %v, want %d", tt.rate, tt.amount, tt.from, tt.to, got, err, tt.want)
+		}
+	}
+}
+
+func TestRateConvertOverflow(t *testing.T) {
+	rate, _ := ParseRate("2")
+	if _, err := rate.Convert(math.MaxInt64, GBP, EUR); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("converting the largest amount at 2 returned %v, want ErrAmountOverflow", err)
+	}
+	if got, err := rate.Convert(math.MaxInt64/2, GBP, EUR); err != nil || got != math.MaxInt64-1 {
+		t.Errorf("converting half the largest amount at 2 = %d, %v", got, err)
+	}
+}
+
+func TestRateInverse(t *testing.T) {
+	rate, _ := ParseRate("1.25")
+	if got, want := rate.Inverse(), Rate(80000000); got != want {
+		t.Errorf("inverse of 1.25 = %s, want %s", got, want)
+	}
+	if got := Rate(0).Inverse(); got != 0 {
+		t.Errorf("inverse of 0 = %s, want 0", got)
+	}
+}
+
+func TestRateWithSpread(t *testing.T) {
+	rate, _ := ParseRate("1.2")
+	if got, want := rate.WithSpread(50), Rate(119400000); got != want {
+		t.Errorf("1.2 with a 50 bps spread = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,249 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/holds"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAccountFrozen       = errors.New("account is frozen")
+	ErrAccountClosed       = errors.New("account is closed")
+	ErrDestinationInactive = errors.New("destination account cannot receive payments")
+	ErrAccountNotFrozen    = errors.New("account is not frozen")
+	ErrFrozenByStaff       = errors.New("account was frozen by staff")
+	ErrPotsNotEmpty        = errors.New("account pots must be emptied first")
+	ErrFundsOnHold         = errors.New("account has funds on hold")
+	ErrSweepRequired       = errors.New("a sweep account is required to close an account with a balance")
+	ErrInvalidSweepAccount = errors.New("sweep account must be another active account of the same owner")
+)
+
+// checkActive rejects money movements on frozen or closed accounts
+func checkActive(account *model.BankAccount) error {
+	switch account.Status {
+	case model.ACCOUNT_FROZEN:
+		return ErrAccountFrozen
+	case model.ACCOUNT_CLOSED:
+		return ErrAccountClosed
+	}
+	return nil
+}
+
+// checkAvailable rejects debits that would spend funds on hold.
+// The account must be locked by the caller.
+func checkAvailable(tx *gorm.DB, account *model.BankAccount, amount money.Amount) error {
+	available, err := holds.Available(tx, account)
+	if err != nil {
+		return err
+	}
+	if available < amount {
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+// AccountRequest describes a status change of a bank account
+type AccountRequest struct {
+	ActorID   uint // the owner, or a member of staff when Staff is set
+	AccountID uint
+	Staff     bool // staff may act on any account
+	Reason    string
+
+	SweepAccountID *uint // closure only, receives the remaining balance
+}
+
+// lockOwnAccount locks an account the actor may change
+func lockOwnAccount(tx *gorm.DB, req AccountRequest) (*model.BankAccount, error) {
+	accounts, err := ledger.LockAccounts(tx, req.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	account, ok := accounts[req.AccountID]
+	if !ok || (!req.Staff && account.UserID != req.ActorID) {
+		return nil, ErrAccountNotFound
+	}
+	return account, nil
+}
+
+// Freeze blocks every money movement on an account until it is unfrozen.
+// Staff may also take over a freeze the owner placed, so only staff can lift it.
+func Freeze(db *gorm.DB, req AccountRequest) (*model.BankAccount, error) {
+	var account *model.BankAccount
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if account, err = lockOwnAccount(tx, req); err != nil {
+			return err
+		}
+
+		switch {
+		case account.Status == model.ACCOUNT_CLOSED:
+			return ErrAccountClosed
+		case account.Status == model.ACCOUNT_FROZEN && (!req.Staff || account.FrozenByStaff):
+			return ErrAccountFrozen
+		}
+
+		now := time.Now()
+		account.Status = model.ACCOUNT_FROZEN
+		account.IsActive = false
+		account.FrozenAt = &now
+		account.FreezeReason = strings.TrimSpace(req.Reason)
+		account.FrozenByStaff = req.Staff
+		return tx.Save(account).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Unfreeze lifts a freeze, owners cannot lift a freeze placed by staff
+func Unfreeze(db *gorm.DB, req AccountRequest) (*model.BankAccount, error) {
+	var account *model.BankAccount
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if account, err = lockOwnAccount(tx, req); err != nil {
+			return err
+		}
+
+		if account.Status != model.ACCOUNT_FROZEN {
+			return ErrAccountNotFrozen
+		}
+		if account.FrozenByStaff && !req.Staff {
+			return ErrFrozenByStaff
+		}
+
+		account.Status = model.ACCOUNT_ACTIVE
+		account.IsActive = true
+		account.FrozenAt = nil
+		account.FreezeReason = ""
+		account.FrozenByStaff = false
+		return tx.Save(account).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Close permanently closes an active account. Pots must be empty and no funds may be
+// on hold. A remaining balance is first swept to another active
+// account of the same owner. Its cards and scheduled payments are cancelled.
+func Close(db *gorm.DB, req AccountRequest) (*model.AccountClosure, error) {
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	var closure *model.AccountClosure
+	err := db.Transaction(func(tx *gorm.DB) error {
+		ids := []uint{req.AccountID}
+		if req.SweepAccountID != nil {
+			if *req.SweepAccountID == req.AccountID {
+				return ErrInvalidSweepAccount
+			}
+			ids = append(ids, *req.SweepAccountID)
+		}
+		accounts, err := ledger.LockAccounts(tx, ids...)
+		if err != nil {
+			return err
+		}
+		account, ok := accounts[req.AccountID]
+		if !ok || (!req.Staff && account.UserID != req.ActorID) {
+			return ErrAccountNotFound
+		}
+		if err := checkActive(account); err != nil {
+			return err
+		}
+
+		var potBalance money.Amount
+		if err := tx.Model(&model.Pot{}).
+			Where("bank_account_id = ?", account.ID).
+			Select("COALESCE(SUM(balance), 0)").
+			Scan(&potBalance).Error; err != nil {
+			return err
+		}
+		if potBalance != 0 {
+			return ErrPotsNotEmpty
+		}
+
+		held, err := holds.Held(tx, account.ID)
+		if err != nil {
+			return err
+		}
+		if held > 0 {
+			return ErrFundsOnHold
+		}
+
+		closure = &model.AccountClosure{
+			BankAccountID: account.ID,
+			UserID:        account.UserID,
+			ClosedByID:    req.ActorID,
+			Reason:        req.Reason,
+		}
+
+		if account.Balance > 0 {
+			if req.SweepAccountID == nil {
+				return ErrSweepRequired
+			}
+			sweep, ok := accounts[*req.SweepAccountID]
+			if !ok || sweep.UserID != account.UserID || sweep.Status != model.ACCOUNT_ACTIVE {
+				return ErrInvalidSweepAccount
+			}
+
+			transaction, err := Transfer(tx, TransferRequest{
+				UserID:        account.UserID,
+				FromAccountID: account.ID,
+				ToAccountID:   sweep.ID,
+				Amount:        account.Balance,
+				Description:   fmt.Sprintf("Closing balance of account %s", account.AccountNumber),
+			})
+			if err != nil {
+				return err
+			}
+			closure.SweepAccountID = &sweep.ID
+			closure.SweepTransactionID = &transaction.ID
+			closure.SweptAmount = transaction.Amount
+		}
+
+		now := time.Now()
+		if err := tx.Model(account).Updates(map[string]any{
+			"status":    model.ACCOUNT_CLOSED,
+			"is_active": false,
+			"closed_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.Card{}).
+			Where("bank_account_id = ? AND status <> ?", account.ID, model.CARD_CANCELLED).
+			Updates(map[string]any{
+				"status":        model.CARD_CANCELLED,
+				"is_active":     false,
+				"cancelled_at":  now,
+				"cancel_reason": model.CARD_ACCOUNT_CLOSED,
+			}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.ScheduledPayment{}).
+			Where("(from_account_id = ? OR to_account_id = ?) AND status IN ?", account.ID, account.ID,
+				[]model.ScheduleStatus{model.SCHEDULE_ACTIVE, model.SCHEDULE_PAUSED}).
+			Updates(map[string]any{"status": model.SCHEDULE_CANCELLED, "last_error": "account closed"}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(closure).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return closure, nil
+}
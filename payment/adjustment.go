@@ -0,0 +1,100 @@
+package payment
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/util"
+
+	"gorm.io/gorm"
+)
+
+var ErrReasonRequired = errors.New("a reason is required")
+
+// AdjustmentRequest describes a manual balance correction by an admin
+type AdjustmentRequest struct {
+	AdminID   uint
+	AccountID uint
+	Amount    money.Amount // signed, in minor units of the account currency
+	Reason    string
+}
+
+// Adjust corrects an account balance against the adjustments ledger account
+// and records who made the change and why
+func Adjust(db *gorm.DB, req AdjustmentRequest) (*model.Transaction, error) {
+	if req.Amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	var transaction *model.Transaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		accounts, err := ledger.LockAccounts(tx, req.AccountID)
+		if err != nil {
+			return err
+		}
+		account, ok := accounts[req.AccountID]
+		if !ok {
+			return ErrAccountNotFound
+		}
+		// Staff may correct frozen accounts, closed ones are final
+		if account.Status == model.ACCOUNT_CLOSED {
+			return ErrAccountClosed
+		}
+
+		amount := req.Amount
+		if amount < 0 {
+			amount = -amount
+		}
+		transaction = &model.Transaction{
+			Amount:      amount,
+			Currency:    account.Currency,
+			ToAmount:    amount,
+			ToCurrency:  account.Currency,
+			Description: req.Reason,
+			Type:        model.ADJUSTMENT,
+			Status:      model.PENDING,
+			Reference:   util.GenerateTransactionReference(),
+		}
+		if req.Amount > 0 {
+			transaction.ToAccountID = &account.ID
+		} else {
+			transaction.FromAccountID = &account.ID
+			if err := checkAvailable(tx, account, amount); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(transaction).Error; err != nil {
+			return err
+		}
+		entry := ledger.Adjustment(account.ID, req.Amount, account.Currency, transaction.Reference)
+		entry.TransactionID = &transaction.ID
+		if err := ledger.Post(tx, entry); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&model.BalanceAdjustment{
+			TransactionID: transaction.ID,
+			BankAccountID: account.ID,
+			AdminID:       req.AdminID,
+			Amount:        req.Amount,
+			Currency:      account.Currency,
+			Reason:        req.Reason,
+		}).Error; err != nil {
+			return err
+		}
+
+		return Transition(tx, transaction, model.COMPLETED, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
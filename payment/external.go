@@ -0,0 +1,121 @@
+package payment
+
+import (
+	"errors"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/util"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAccountNotFound       = errors.New("unauthorized or account not found")
+	ErrCounterpartyRequired  = errors.New("counterparty name and account are required")
+	ErrExternalRefDuplicated = errors.New("external reference was already processed")
+)
+
+// ExternalRequest describes money entering or leaving the bank through one account
+type ExternalRequest struct {
+	UserID              uint
+	AccountID           uint
+	Amount              money.Amount // in minor units of the account currency
+	Description         string
+	CounterpartyName    string // source of a deposit or destination of a withdrawal
+	CounterpartyAccount string
+	ExternalReference   string // optional reference assigned by the external bank
+}
+
+// Deposit credits an account with money arriving from an external account
+func Deposit(db *gorm.DB, req ExternalRequest) (*model.Transaction, error) {
+	return external(db, req, model.DEPOSIT)
+}
+
+// Withdraw debits an account for money sent to an external account
+func Withdraw(db *gorm.DB, req ExternalRequest) (*model.Transaction, error) {
+	return external(db, req, model.WITHDRAWAL)
+}
+
+func external(db *gorm.DB, req ExternalRequest, kind model.TransactionType) (*model.Transaction, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if req.CounterpartyName == "" || req.CounterpartyAccount == "" {
+		return nil, ErrCounterpartyRequired
+	}
+
+	var transaction *model.Transaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		accounts, err := ledger.LockAccounts(tx, req.AccountID)
+		if err != nil {
+			return err
+		}
+		account, ok := accounts[req.AccountID]
+		if !ok || account.UserID != req.UserID {
+			return ErrAccountNotFound
+		}
+
+		transaction = &model.Transaction{
+			Amount:              req.Amount,
+			Currency:            account.Currency,
+			ToAmount:            req.Amount,
+			ToCurrency:          account.Currency,
+			Description:         req.Description,
+			Type:                kind,
+			Status:              model.PENDING,
+			Reference:           util.GenerateTransactionReference(),
+			CounterpartyName:    req.CounterpartyName,
+			CounterpartyAccount: req.CounterpartyAccount,
+			ExternalReference:   req.ExternalReference,
+		}
+
+		var entry *model.JournalEntry
+		if kind == model.DEPOSIT {
+			transaction.ToAccountID = &account.ID
+			entry = ledger.Deposit(account.ID, req.Amount, account.Currency, transaction.Reference)
+		} else {
+			transaction.FromAccountID = &account.ID
+			entry = ledger.Withdrawal(account.ID, req.Amount, account.Currency, transaction.Reference)
+		}
+
+		if err := checkActive(account); err != nil {
+			return err
+		}
+
+		// The same external payment must not be credited twice
+		if req.ExternalReference != "" {
+			var count int64
+			if err := tx.Model(&model.Transaction{}).
+				Where("type = ? AND external_reference = ? AND status <> ?", kind, req.ExternalReference, model.FAILED).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrExternalRefDuplicated
+			}
+		}
+
+		if kind == model.WITHDRAWAL {
+			if err := checkAvailable(tx, account, req.Amount); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(transaction).Error; err != nil {
+			return err
+		}
+		entry.TransactionID = &transaction.ID
+		if err := ledger.Post(tx, entry); err != nil {
+			return err
+		}
+
+		return Transition(tx, transaction, model.COMPLETED, "")
+	})
+	if err != nil {
+		recordFailure(db, transaction, err)
+		return nil, err
+	}
+	return transaction, nil
+}
@@ -0,0 +1,115 @@
+package payment
+
+import (
+	"errors"
+	"time"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/util"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPotNotFound = errors.New("pot not found or unauthorized")
+	ErrPotLocked   = errors.New("pot is locked")
+)
+
+// PotRequest describes a movement between a pot and its bank account
+type PotRequest struct {
+	UserID      uint
+	PotID       uint
+	Amount      money.Amount // in minor units of the pot currency
+	Description string
+}
+
+// MoveToPot sets money aside from the account into the pot
+func MoveToPot(db *gorm.DB, req PotRequest) (*model.Transaction, error) {
+	return movePot(db, req, model.POT_DEPOSIT)
+}
+
+// MoveFromPot returns money from the pot to its account
+func MoveFromPot(db *gorm.DB, req PotRequest) (*model.Transaction, error) {
+	return movePot(db, req, model.POT_WITHDRAWAL)
+}
+
+func movePot(db *gorm.DB, req PotRequest, kind model.TransactionType) (*model.Transaction, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	var transaction *model.Transaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var pot model.Pot
+		if err := tx.Where("id = ? AND user_id = ?", req.PotID, req.UserID).First(&pot).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPotNotFound
+			}
+			return err
+		}
+
+		// Accounts are always locked before their pots
+		accounts, err := ledger.LockAccounts(tx, pot.BankAccountID)
+		if err != nil {
+			return err
+		}
+		account, ok := accounts[pot.BankAccountID]
+		if !ok {
+			return ErrAccountNotFound
+		}
+		if err := checkActive(account); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pot, pot.ID).Error; err != nil {
+			return err
+		}
+
+		transaction = &model.Transaction{
+			Amount:      req.Amount,
+			Currency:    pot.Currency,
+			ToAmount:    req.Amount,
+			ToCurrency:  pot.Currency,
+			Description: req.Description,
+			Type:        kind,
+			Status:      model.PENDING,
+			Reference:   util.GenerateTransactionReference(),
+			PotID:       &pot.ID,
+		}
+
+		var entry *model.JournalEntry
+		if kind == model.POT_DEPOSIT {
+			transaction.FromAccountID = &account.ID
+			if err := checkAvailable(tx, account, req.Amount); err != nil {
+				return err
+			}
+			entry = ledger.PotDeposit(account.ID, pot.ID, req.Amount, pot.Currency, transaction.Reference)
+		} else {
+			transaction.ToAccountID = &account.ID
+			if pot.LockedUntil != nil && time.Now().Before(*pot.LockedUntil) {
+				return ErrPotLocked
+			}
+			if pot.Balance < req.Amount {
+				return ErrInsufficientFunds
+			}
+			entry = ledger.PotWithdrawal(account.ID, pot.ID, req.Amount, pot.Currency, transaction.Reference)
+		}
+
+		if err := tx.Create(transaction).Error; err != nil {
+			return err
+		}
+		entry.TransactionID = &transaction.ID
+		if err := ledger.Post(tx, entry); err != nil {
+			return err
+		}
+
+		return Transition(tx, transaction, model.COMPLETED, "")
+	})
+	if err != nil {
+		recordFailure(db, transaction, err)
+		return nil, err
+	}
+	return transaction, nil
+}
@@ -0,0 +1,112 @@
+package payment
+
+import (
+	"errors"
+	"log"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/ledger"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIllegalTransition = errors.New("illegal transaction status transition")
+	ErrNotPosted         = errors.New("transaction was authorised but never posted")
+)
+
+// Transition moves a transaction to a new status, enforcing the lifecycle.
+// The update only applies if nobody changed the status concurrently.
+func Transition(tx *gorm.DB, transaction *model.Transaction, to model.TransactionStatus, reason string) error {
+	if !transaction.Status.CanTransition(to) {
+		return ErrIllegalTransition
+	}
+
+	result := tx.Model(&model.Transaction{}).
+		Where("id = ? AND status = ?", transaction.ID, transaction.Status).
+		Updates(map[string]any{"status": to, "failure_reason": reason})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIllegalTransition
+	}
+
+	transaction.Status = to
+	transaction.FailureReason = reason
+	return nil
+}
+
+// recordFailure persists a failed attempt outside the rolled back database transaction
+// so the account holder and support can see why it did not go through
+func recordFailure(db *gorm.DB, transaction *model.Transaction, cause error) {
+	if transaction == nil {
+		return
+	}
+
+	failed := *transaction
+	failed.Model = gorm.Model{}
+	failed.Status = model.FAILED
+	failed.FailureReason = cause.Error()
+	// Failed deposits stay with the account they were for, it belongs to the sender
+	if failed.FromAccountID != nil && failed.ToAccountID != nil {
+		failed.AttemptedToAccountID = failed.ToAccountID
+		failed.ToAccountID = nil
+	}
+	if err := db.Create(&failed).Error; err != nil {
+		log.Printf("could not record failed transaction %s: %v", failed.Reference, err)
+	}
+}
+
+// Reverse undoes a completed transaction by posting the mirror of its journal entry.
+// Authorised transactions have no journal entry yet and return ErrNotPosted, card
+// payments are reversed by releasing their authorization instead.
+func Reverse(db *gorm.DB, transactionID uint, reason string) (*model.Transaction, error) {
+	var transaction model.Transaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&transaction, transactionID).Error; err != nil {
+			return err
+		}
+		if !transaction.Status.CanTransition(model.REVERSED) {
+			return ErrIllegalTransition
+		}
+		if transaction.Status == model.AUTHORISED {
+			return ErrNotPosted
+		}
+
+		var entry model.JournalEntry
+		if err := tx.Preload("Postings").Where("transaction_id = ?", transaction.ID).First(&entry).Error; err != nil {
+			return err
+		}
+
+		// Lock every customer account the reversal touches
+		var ids []uint
+		for _, p := range entry.Postings {
+			if p.BankAccountID != nil {
+				ids = append(ids, *p.BankAccountID)
+			}
+		}
+		accounts, err := ledger.LockAccounts(tx, ids...)
+		if err != nil {
+			return err
+		}
+		// Frozen accounts can still be corrected, closed ones are final
+		for _, account := range accounts {
+			if account.Status == model.ACCOUNT_CLOSED {
+				return ErrAccountClosed
+			}
+		}
+
+		reversal := ledger.Reverse(&entry, "Reversal of "+transaction.Reference)
+		reversal.TransactionID = &transaction.ID
+		if err := ledger.Post(tx, reversal); err != nil {
+			return err
+		}
+
+		return Transition(tx, &transaction, model.REVERSED, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
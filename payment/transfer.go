@@ -0,0 +1,147 @@
+package payment
+
+import (
+	"errors"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/fx"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/denver-code/moza-backend/money"
+	"github.com/denver-code/moza-backend/util"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAmount       = errors.New("amount must be positive")
+	ErrSameAccount         = errors.New("cannot transfer to the same account")
+	ErrSourceNotFound      = errors.New("unauthorized or account not found")
+	ErrDestinationNotFound = errors.New("destination account not found")
+	ErrAmountTooSmall      = errors.New("amount is too small to convert")
+	ErrInsufficientFunds   = ledger.ErrInsufficientFunds
+)
+
+// TransferRequest describes a movement between two bank accounts on behalf of a user
+type TransferRequest struct {
+	UserID        uint
+	FromAccountID uint
+	ToAccountID   uint
+	Amount        money.Amount // in minor units of the source currency
+	Description   string
+	QuoteID       *uint // optional FX quote locking the rate
+
+	ScheduledPaymentID *uint // set when executed by the scheduler
+}
+
+// Transfer moves money between accounts in a single database transaction.
+// Both accounts are locked before the balance check, so concurrent transfers
+// from the same account cannot overdraw it.
+func Transfer(db *gorm.DB, req TransferRequest) (*model.Transaction, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if req.FromAccountID == req.ToAccountID {
+		return nil, ErrSameAccount
+	}
+
+	var transaction *model.Transaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		accounts, err := ledger.LockAccounts(tx, req.FromAccountID, req.ToAccountID)
+		if err != nil {
+			return err
+		}
+
+		// Verify ownership of the source account
+		fromAccount, ok := accounts[req.FromAccountID]
+		if !ok || fromAccount.UserID != req.UserID {
+			return ErrSourceNotFound
+		}
+
+		// From here on failures are recorded against the source account
+		transaction = &model.Transaction{
+			FromAccountID: &fromAccount.ID,
+			ToAccountID:   &req.ToAccountID,
+			Amount:        req.Amount,
+			Currency:      fromAccount.Currency,
+			ToAmount:      req.Amount,
+			Description:   req.Description,
+			Type:          model.TRANSFER,
+			Status:        model.PENDING,
+			Reference:     util.GenerateTransactionReference(),
+
+			ScheduledPaymentID: req.ScheduledPaymentID,
+		}
+
+		if err := checkActive(fromAccount); err != nil {
+			return err
+		}
+
+		toAccount, ok := accounts[req.ToAccountID]
+		if !ok {
+			return ErrDestinationNotFound
+		}
+		transaction.ToCurrency = toAccount.Currency
+		if toAccount.Status != model.ACCOUNT_ACTIVE {
+			return ErrDestinationInactive
+		}
+
+		if err := checkAvailable(tx, fromAccount, req.Amount); err != nil {
+			return err
+		}
+
+		// Convert the amount when the accounts hold different currencies
+		if fromAccount.Currency != toAccount.Currency {
+			if err := applyExchange(tx, transaction, req); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(transaction).Error; err != nil {
+			return err
+		}
+
+		// Post balanced ledger entry, which also updates both balances
+		entry := ledger.Transfer(fromAccount.ID, toAccount.ID, transaction.Amount, transaction.Currency, transaction.Reference)
+		if fromAccount.Currency != toAccount.Currency {
+			entry = ledger.ExchangeTransfer(fromAccount.ID, toAccount.ID, transaction.Amount, transaction.Currency, transaction.ToAmount, transaction.ToCurrency, transaction.Reference)
+		}
+		entry.TransactionID = &transaction.ID
+		if err := ledger.Post(tx, entry); err != nil {
+			return err
+		}
+
+		return Transition(tx, transaction, model.COMPLETED, "")
+	})
+	if err != nil {
+		recordFailure(db, transaction, err)
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// applyExchange fills in the destination leg from a locked quote or the live rate
+func applyExchange(tx *gorm.DB, transaction *model.Transaction, req TransferRequest) error {
+	if req.QuoteID != nil {
+		quote, err := fx.UseQuote(tx, *req.QuoteID, req.UserID, transaction.Amount, transaction.Currency, transaction.ToCurrency)
+		if err != nil {
+			return err
+		}
+		transaction.ToAmount = quote.ToAmount
+		transaction.ExchangeRate = quote.Rate
+		transaction.SpreadBps = quote.SpreadBps
+		transaction.FXQuoteID = &quote.ID
+	} else {
+		conversion, err := fx.Convert(tx, transaction.Amount, transaction.Currency, transaction.ToCurrency)
+		if err != nil {
+			return err
+		}
+		transaction.ToAmount = conversion.ToAmount
+		transaction.ExchangeRate = conversion.Rate
+		transaction.SpreadBps = conversion.SpreadBps
+	}
+
+	if transaction.ToAmount <= 0 {
+		return ErrAmountTooSmall
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/ledger"
+	"github.com/denver-code/moza-backend/money"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB opens the Postgres database in TEST_DATABASE_DSN in a fresh schema that is
+// dropped when the test ends, or skips the test when no database is configured
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+	admin, err := gorm.Open(postgres.Open(dsn), config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := fmt.Sprintf("payment_test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+	})
+
+	// Every pooled connection has to use the schema, so it goes in the DSN
+	if strings.Contains(dsn, "://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := gorm.Open(postgres.Open(dsn), config)
+	if err != nil {
+		t.Fatalf("connect to schema: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&model.BankAccount{},
+		&model.Transaction{},
+		&model.JournalEntry{},
+		&model.Posting{},
+		&model.ExchangeRate{},
+		&model.FXQuote{},
+		&model.Hold{},
+	); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("pool: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(20)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// TestTransferConcurrent fires parallel transfers in random directions between a
+// few accounts and checks that no money is created or lost and no balance goes negative
+func TestTransferConcurrent(t *testing.T) {
+	db := testDB(t)
+
+	const (
+		userID    = 1
+		accounts  = 8
+		transfers = 500
+		opening   = money.Amount(10000)
+	)
+
+	ids := make([]uint, accounts)
+	for i := range ids {
+		account := &model.BankAccount{
+			UserID:        userID,
+			AccountType:   model.CHECKING,
+			Currency:      model.GBP,
+			AccountNumber: fmt.Sprintf("TEST%08d", i),
+			Status:        model.ACCOUNT_ACTIVE,
+			IsActive:      true,
+			LastActivity:  time.Now(),
+		}
+		if err := db.Create(account).Error; err != nil {
+			t.Fatalf("create account: %v", err)
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return ledger.Post(tx, ledger.Deposit(account.ID, opening, account.Currency, "Opening balance"))
+		}); err != nil {
+			t.Fatalf("fund account: %v", err)
+		}
+		ids[i] = account.ID
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		completed int
+		refused   int
+		failures  []error
+	)
+	for range transfers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			from := rand.IntN(accounts)
+			to := (from + 1 + rand.IntN(accounts-1)) % accounts
+
+			_, err := Transfer(db, TransferRequest{
+				UserID:        userID,
+				FromAccountID: ids[from],
+				ToAccountID:   ids[to],
+				Amount:        money.Amount(1 + rand.IntN(int(opening)/2)),
+				Description:   "concurrency test",
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				completed++
+			case errors.Is(err, ErrInsufficientFunds):
+				refused++
+			default:
+				failures = append(failures, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range failures {
+		t.Errorf("transfer failed: %v", err)
+	}
+	if completed == 0 {
+		t.Fatal("no transfer completed")
+	}
+	t.Logf("%d transfers completed, %d refused for insufficient funds", completed, refused)
+
+	var total money.Amount
+	for _, id := range ids {
+		var account model.BankAccount
+		if err := db.First(&account, id).Error; err != nil {
+			t.Fatalf("load account: %v", err)
+		}
+		if account.Balance < 0 {
+			t.Errorf("account %d has a negative balance of %d", id, account.Balance)
+		}
+		balance, err := ledger.Balance(db, id)
+		if err != nil {
+			t.Fatalf("ledger balance: %v", err)
+		}
+		if balance != account.Balance {
+			t.Errorf("account %d caches %d but its ledger balance is %d", id, account.Balance, balance)
+		}
+		total += account.Balance
+	}
+	if want := opening * accounts; total != want {
+		t.Errorf("accounts hold %d in total, want %d", total, want)
+	}
+}
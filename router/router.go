@@ -1,8 +1,11 @@
 package router
 
 import (
+	"github.com/denver-code/moza-backend/database/model"
 	"github.com/denver-code/moza-backend/handler"
+	"github.com/denver-code/moza-backend/handler/admin"
 	"github.com/denver-code/moza-backend/handler/banking"
+	"github.com/denver-code/moza-backend/handler/network"
 	"github.com/denver-code/moza-backend/middleware"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,6 +14,8 @@ import (
 
 // SetupRoutes setup router api
 func SetupRoutes(app *fiber.App) {
+	app.Get("/.well-known/jwks.json", handler.JWKS)
+
 	// Middleware
 	api := app.Group("/api", logger.New())
 	api.Get("/", handler.Hello)
@@ -19,6 +24,13 @@ func SetupRoutes(app *fiber.App) {
 	auth := api.Group("/auth")
 	auth.Post("/login", handler.Login)
 	auth.Post("/register", handler.Register)
+	auth.Post("/refresh", handler.Refresh)
+	auth.Post("/logout", middleware.Protected(), handler.Logout)
+	auth.Post("/logout-all", middleware.Protected(), handler.LogoutAll)
+	auth.Post("/2fa", handler.LoginTwoFactor)
+	auth.Post("/password/forgot", handler.ForgotPassword)
+	auth.Post("/password/reset", handler.ResetPassword)
+	auth.Post("/email/verify", handler.VerifyEmail)
 
 	// Private
 	private := api.Group("/private")
@@ -27,21 +39,93 @@ func SetupRoutes(app *fiber.App) {
 	// User
 	user := api.Group("/user")
 	user.Get("/profile", middleware.Protected(), handler.GetProfile)
+	user.Patch("/profile", middleware.Protected(), handler.UpdateProfile)
+	user.Post("/password", middleware.Protected(), handler.ChangePassword)
+	user.Post("/email", middleware.Protected(), handler.ChangeEmail)
+	user.Get("/sessions", middleware.Protected(), handler.GetSessions)
+	user.Delete("/sessions/:id", middleware.Protected(), handler.RevokeSession)
+	user.Post("/email/verification", middleware.Protected(), handler.ResendVerification)
+	user.Post("/2fa/setup", middleware.Protected(), handler.SetupTwoFactor)
+	user.Post("/2fa/confirm", middleware.Protected(), handler.ConfirmTwoFactor)
+	user.Post("/2fa/disable", middleware.Protected(), handler.DisableTwoFactor)
 
 	// Banking
 	banking_group := api.Group("/banking")
 	banking_group.Use(middleware.Protected()) // All banking routes require authentication
+	banking_group.Use(middleware.VerifiedEmail())
 
 	// Bank Accounts
-	banking_group.Post("/accounts", banking.CreateBankAccount)
+	banking_group.Post("/accounts", middleware.Idempotency(), banking.CreateBankAccount)
 	banking_group.Get("/accounts", banking.GetUserAccounts)
 	banking_group.Get("/accounts/:id/transactions", banking.GetAccountTransactions)
+	banking_group.Get("/accounts/:id/ledger", banking.GetAccountLedger)
+	banking_group.Get("/accounts/:id/holds", banking.GetAccountHolds)
+	banking_group.Post("/accounts/:id/freeze", banking.FreezeAccount)
+	banking_group.Post("/accounts/:id/unfreeze", middleware.StepUp(nil), banking.UnfreezeAccount)
+	banking_group.Post("/accounts/:id/close", middleware.Idempotency(), middleware.StepUp(nil), banking.CloseAccount)
+
+	// Pots
+	banking_group.Post("/accounts/:id/pots", banking.CreatePot)
+	banking_group.Get("/accounts/:id/pots", banking.GetPots)
+	banking_group.Post("/pots/:id/deposit", middleware.Idempotency(), banking.DepositToPot)
+	banking_group.Post("/pots/:id/withdraw", middleware.Idempotency(), banking.WithdrawFromPot)
 
 	// Cards
-	banking_group.Post("/cards", banking.CreateCard)
+	banking_group.Post("/cards", middleware.Idempotency(), middleware.StepUp(nil), banking.CreateCard)
 	banking_group.Get("/accounts/:id/cards", banking.GetCards)
+	banking_group.Post("/cards/:id/freeze", banking.FreezeCard)
+	banking_group.Post("/cards/:id/unfreeze", middleware.StepUp(nil), banking.UnfreezeCard)
+	banking_group.Post("/cards/:id/cancel", banking.CancelCard)
+	banking_group.Post("/cards/:id/replace", middleware.Idempotency(), middleware.StepUp(nil), banking.ReplaceCard)
+	banking_group.Get("/cards/:id/authorizations", banking.GetCardAuthorizations)
+	banking_group.Post("/cards/:id/reveal", middleware.StepUp(nil), banking.RevealCard)
 
 	// Transactions
-	banking_group.Post("/transfer", banking.Transfer)
+	banking_group.Post("/transfer", middleware.Idempotency(), middleware.StepUp(middleware.AboveStepUpThreshold), banking.Transfer)
+	banking_group.Post("/deposit", middleware.Idempotency(), banking.Deposit)
+	banking_group.Post("/withdraw", middleware.Idempotency(), middleware.StepUp(middleware.AboveStepUpThreshold), banking.Withdraw)
+
+	// Scheduled payments
+	banking_group.Post("/scheduled-payments", middleware.RequireIdempotency(), middleware.StepUp(middleware.AboveStepUpThreshold), banking.CreateScheduledPayment)
+	banking_group.Get("/scheduled-payments", banking.GetScheduledPayments)
+	banking_group.Post("/scheduled-payments/:id/pause", banking.PauseScheduledPayment)
+	banking_group.Post("/scheduled-payments/:id/resume", banking.ResumeScheduledPayment)
+	banking_group.Post("/scheduled-payments/:id/cancel", banking.CancelScheduledPayment)
+
+	// Foreign exchange
+	banking_group.Get("/fx/rates", banking.GetExchangeRates)
+	banking_group.Post("/fx/quote", banking.CreateQuote)
+
+	// Card network stand-in used by merchants to charge cards
+	network_group := api.Group("/network")
+	network_group.Use(middleware.NetworkKey())
+	network_group.Post("/authorizations", middleware.NetworkIdempotency(), network.Authorize)
+	network_group.Post("/authorizations/:id/capture", middleware.NetworkIdempotency(), network.Capture)
+	network_group.Post("/authorizations/:id/release", network.Release)
+
+	// Admin
+	admin_group := api.Group("/admin")
+	admin_group.Use(middleware.Protected(), middleware.RequireRole(model.ROLE_SUPPORT, model.ROLE_ADMIN)) // Operations staff only
+	adminOnly := middleware.RequireRole(model.ROLE_ADMIN)
+
+	admin_group.Get("/users", admin.SearchUsers)
+	admin_group.Get("/users/:id", admin.GetUser)
+	admin_group.Put("/users/:id/role", adminOnly, admin.SetUserRole)
+	admin_group.Get("/accounts/:id", admin.GetAccount)
+	admin_group.Get("/accounts/:id/transactions", admin.GetAccountTransactions)
+	admin_group.Post("/accounts/:id/freeze", admin.FreezeAccount)
+	admin_group.Post("/accounts/:id/unfreeze", admin.UnfreezeAccount)
+	admin_group.Post("/accounts/:id/close", adminOnly, admin.CloseAccount)
+	admin_group.Post("/accounts/:id/adjust", adminOnly, middleware.RequireIdempotency(), admin.AdjustBalance)
+	admin_group.Post("/accounts/:id/holds", admin.PlaceHold)
+	admin_group.Post("/holds/:id/release", admin.ReleaseHold)
+	admin_group.Post("/cards/:id/freeze", admin.FreezeCard)
+	admin_group.Post("/cards/:id/unfreeze", admin.UnfreezeCard)
+	admin_group.Post("/cards/:id/cancel", admin.CancelCard)
+	admin_group.Put("/fx/rates", adminOnly, admin.SetExchangeRates)
+	admin_group.Post("/transactions/:id/reverse", adminOnly, admin.ReverseTransaction)
+	admin_group.Post("/keys/rotate", adminOnly, admin.RotateSigningKey)
+	admin_group.Get("/audit", adminOnly, admin.GetAuditEvents)
+	admin_group.Get("/audit/verify", adminOnly, admin.VerifyAuditLog)
 
 }
@@ -0,0 +1,180 @@
+package scheduler
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/denver-code/moza-backend/config"
+	"github.com/denver-code/moza-backend/database/model"
+	"github.com/denver-code/moza-backend/payment"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultInterval   = time.Minute
+	DefaultMaxRetries = 3
+	DefaultRetryDelay = time.Hour
+)
+
+// Start runs due scheduled payments every interval until the process exits
+func Start(db *gorm.DB) {
+	interval := duration("SCHEDULER_INTERVAL", DefaultInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if n, err := RunDue(db, now); err != nil {
+			log.Printf("scheduler: %v", err)
+		} else if n > 0 {
+			log.Printf("scheduler: processed %d scheduled payments", n)
+		}
+	}
+}
+
+// RunDue executes every active scheduled payment whose attempt time has passed
+func RunDue(db *gorm.DB, now time.Time) (int, error) {
+	var ids []uint
+	if err := db.Model(&model.ScheduledPayment{}).
+		Where("status = ? AND next_attempt_at <= ?", model.SCHEDULE_ACTIVE, now).
+		Order("next_attempt_at").
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, id := range ids {
+		ran, err := runOne(db, id, now)
+		if err != nil {
+			log.Printf("scheduler: scheduled payment %d: %v", id, err)
+			continue
+		}
+		if ran {
+			processed++
+		}
+	}
+	return processed, nil
+}
+
+// runOne executes a single scheduled payment. The schedule row stays locked for the
+// whole run and rows locked by another instance are skipped.
+func runOne(db *gorm.DB, id uint, now time.Time) (bool, error) {
+	ran := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var schedule model.ScheduledPayment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", id, model.SCHEDULE_ACTIVE, now).
+			First(&schedule).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		ran = true
+
+		transaction, err := payment.Transfer(tx, payment.TransferRequest{
+			UserID:             schedule.UserID,
+			FromAccountID:      schedule.FromAccountID,
+			ToAccountID:        schedule.ToAccountID,
+			Amount:             schedule.Amount,
+			Description:        schedule.Description,
+			ScheduledPaymentID: &schedule.ID,
+		})
+		if err != nil {
+			fail(&schedule, err, now)
+		} else {
+			schedule.LastTransactionID = &transaction.ID
+			schedule.LastError = ""
+			advance(&schedule)
+		}
+
+		return tx.Save(&schedule).Error
+	})
+	return ran, err
+}
+
+// fail schedules a retry, or gives up on the current occurrence once retries are exhausted
+func fail(schedule *model.ScheduledPayment, cause error, now time.Time) {
+	schedule.FailedAttempts++
+	schedule.LastError = cause.Error()
+
+	if schedule.FailedAttempts <= maxRetries() {
+		schedule.NextAttemptAt = now.Add(duration("SCHEDULER_RETRY_DELAY", DefaultRetryDelay))
+		return
+	}
+
+	if schedule.Frequency == model.ONCE {
+		schedule.Status = model.SCHEDULE_FAILED
+		return
+	}
+	// Recurring payments skip the missed occurrence and carry on
+	advance(schedule)
+}
+
+// advance moves the schedule to its next occurrence, completing it when none is left
+func advance(schedule *model.ScheduledPayment) {
+	schedule.Occurrences++
+	schedule.FailedAttempts = 0
+
+	if schedule.Frequency == model.ONCE {
+		schedule.Status = model.SCHEDULE_COMPLETED
+		return
+	}
+
+	next := NextDate(schedule.StartDate, schedule.Frequency, schedule.IntervalDays, schedule.Occurrences)
+	if schedule.EndDate != nil && next.After(*schedule.EndDate) {
+		schedule.Status = model.SCHEDULE_COMPLETED
+		return
+	}
+	schedule.NextPaymentDate = next
+	schedule.NextAttemptAt = next
+}
+
+// NextDate returns the date of occurrence n (zero based) of a schedule.
+// Monthly payments keep their day of month, clamped to the last day of shorter months.
+func NextDate(start time.Time, frequency model.Frequency, intervalDays, n int) time.Time {
+	switch frequency {
+	case model.WEEKLY:
+		return start.AddDate(0, 0, 7*n)
+	case model.CUSTOM:
+		return start.AddDate(0, 0, intervalDays*n)
+	case model.MONTHLY:
+		first := time.Date(start.Year(), start.Month()+time.Month(n), 1, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		lastDay := first.AddDate(0, 1, -1).Day()
+		return first.AddDate(0, 0, min(start.Day(), lastDay)-1)
+	}
+	return start
+}
+
+func maxRetries() int {
+	n, err := strconv.Atoi(config.Config("SCHEDULER_MAX_RETRIES"))
+	if err != nil || n < 0 {
+		return DefaultMaxRetries
+	}
+	return n
+}
+
+func duration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(config.Config(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// SkipMissed moves a recurring schedule past occurrences that fell due while it was
+// paused, so resuming does not trigger a burst of catch-up payments
+func SkipMissed(schedule *model.ScheduledPayment, now time.Time) {
+	if schedule.Frequency == model.ONCE {
+		if schedule.NextAttemptAt.Before(now) {
+			schedule.NextAttemptAt = now
+		}
+		return
+	}
+	for schedule.Status == model.SCHEDULE_ACTIVE && schedule.NextPaymentDate.Before(now) {
+		advance(schedule)
+	}
+}
@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/denver-code/moza-backend/database/model"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+}
+
+func TestNextDate(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     time.Time
+		frequency model.Frequency
+		interval  int
+		n         int
+		want      time.Time
+	}{
+		{"once", date(2024, 3, 5), model.ONCE, 0, 3, date(2024, 3, 5)},
+		{"first weekly", date(2024, 3, 5), model.WEEKLY, 0, 0, date(2024, 3, 5)},
+		{"weekly", date(2024, 3, 5), model.WEEKLY, 0, 4, date(2024, 4, 2)},
+		{"custom", date(2024, 3, 5), model.CUSTOM, 10, 3, date(2024, 4, 4)},
+		{"monthly", date(2024, 1, 15), model.MONTHLY, 0, 1, date(2024, 2, 15)},
+		{"monthly across years", date(2024, 11, 15), model.MONTHLY, 0, 3, date(2025, 2, 15)},
+		{"clamped in a leap year", date(2024, 1, 31), model.MONTHLY, 0, 1, date(2024, 2, 29)},
+		{"clamped", date(2023, 1, 31), model.MONTHLY, 0, 1, date(2023, 2, 28)},
+		{"clamped to 30 days", date(2024, 1, 31), model.MONTHLY, 0, 3, date(2024, 4, 30)},
+		{"day kept after a short month", date(2024, 1, 31), model.MONTHLY, 0, 2, date(2024, 3, 31)},
+	}
+	for _, tt := range tests {
+		if got := NextDate(tt.start, tt.frequency, tt.interval, tt.n); !got.Equal(tt.want) {
+			t.Errorf("%s: NextDate = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
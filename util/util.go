@@ -1,10 +1,13 @@
 package util
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"strconv"
-	"time"
+	"strings"
+	"sync"
 
 	"github.com/denver-code/moza-backend/database"
 	"github.com/denver-code/moza-backend/database/model"
@@ -17,23 +20,36 @@ func GenerateAccountNumber() string {
 	return fmt.Sprintf("%d", rand.Intn(900000000)+100000000)
 }
 
-func GenerateCardNumber() string {
-	return fmt.Sprintf("%d", rand.Intn(9000000000000000)+1000000000000000)
+// GenerateTransactionReference returns a random reference, so transactions created
+// at the same moment cannot collide on the unique index
+func GenerateTransactionReference() string {
+	b := make([]byte, 10)
+	if _, err := crand.Read(b); err != nil {
+		panic("could not read random bytes: " + err.Error())
+	}
+	return "TXN" + strings.ToUpper(hex.EncodeToString(b))
 }
 
-func GenerateCVV() string {
-	return fmt.Sprintf("%d", rand.Intn(900)+100)
-}
+// passwordCost is the bcrypt cost of stored password hashes
+const passwordCost = 14
 
-func GenerateTransactionReference() string {
-	return fmt.Sprintf("TXN%d", time.Now().UnixNano())
-}
+// dummyHash is a hash at the real cost that no password is checked against successfully
+var dummyHash = sync.OnceValue(func() string {
+	bytes, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), passwordCost)
+	return string(bytes)
+})
 
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 	return string(bytes), err
 }
 
+// CheckDummyPassword takes as long as checking a real password, so a login for an
+// unknown identity cannot be told apart by its response time
+func CheckDummyPassword(password string) {
+	CheckPasswordHash(password, dummyHash())
+}
+
 // CheckPasswordHash compare password with hash
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))